@@ -0,0 +1,40 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/services"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type AlertController struct {
+	AlertService *services.AlertService
+}
+
+func NewAlertController(alertService *services.AlertService) *AlertController {
+	return &AlertController{
+		AlertService: alertService,
+	}
+}
+
+// 绑定Router
+func (controller AlertController) BindRouter(base *mux.Router) {
+	subrouter := base.PathPrefix("/alerts").Subrouter()
+	subrouter.HandleFunc("", controller.GetAlerts).Methods(http.MethodGet)
+}
+
+// 获取告警列表，默认仅返回pending及firing告警，?all=true时包含resolved告警
+func (controller AlertController) GetAlerts(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	alerts := controller.AlertService.GetAlerts(all)
+	bytes, err := json.Marshal(alerts)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"server/modules"
+	"server/services"
+
+	"github.com/gorilla/mux"
+)
+
+type ChannelController struct {
+	ChannelService *services.ChannelService
+}
+
+func NewChannelController(channelService *services.ChannelService) *ChannelController {
+	return &ChannelController{
+		ChannelService: channelService,
+	}
+}
+
+// 绑定Router
+func (controller ChannelController) BindRouter(base *mux.Router) {
+	subrouter := base.PathPrefix("/channels").Subrouter()
+	subrouter.HandleFunc("", controller.GetChannels).Methods(http.MethodGet)
+	subrouter.HandleFunc("/{name}/test", controller.TestChannel).Methods(http.MethodPost)
+	subrouter.HandleFunc("/{name}/digest", controller.SendDigest).Methods(http.MethodPost)
+}
+
+// 获取通知渠道列表
+func (controller ChannelController) GetChannels(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	channels := controller.ChannelService.GetChannels()
+	bytes, err := json.Marshal(channels)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 发送测试通知，发送失败时返回502及测试结果
+func (controller ChannelController) TestChannel(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	name := vars["name"]
+	result, err := controller.ChannelService.TestChannel(name)
+	if err != nil {
+		if errors.Is(err, modules.ErrChannelNotFound) {
+			w.WriteHeader(404)
+		} else {
+			w.WriteHeader(500)
+		}
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if !result.Success {
+		w.WriteHeader(502)
+	}
+	w.Write(bytes)
+}
+
+// 立即发送汇总报告
+func (controller ChannelController) SendDigest(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	name := vars["name"]
+	err := controller.ChannelService.SendDigest(name)
+	if err != nil {
+		switch {
+		case errors.Is(err, modules.ErrChannelNotFound):
+			w.WriteHeader(404)
+		case errors.Is(err, modules.ErrChannelNotSupport):
+			w.WriteHeader(400)
+		default:
+			w.WriteHeader(502)
+		}
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte("true"))
+}
@@ -2,8 +2,14 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"server/modules"
 	"server/services"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -22,6 +28,26 @@ func NewDatasourceController(datasourceService *services.DatasourceService) *Dat
 func (controller DatasourceController) BindRouter(base *mux.Router) {
 	subrouter := base.PathPrefix("/datasources").Subrouter()
 	subrouter.HandleFunc("", controller.GetDatasources).Methods(http.MethodGet)
+	subrouter.HandleFunc("/test", controller.TestNewDatasource).Methods(http.MethodPost)
+	subrouter.HandleFunc("/{code}/test", controller.TestDatasource).Methods(http.MethodPost)
+	subrouter.HandleFunc("/{code}/usages", controller.GetUsages).Methods(http.MethodGet)
+	subrouter.HandleFunc("/{code}", controller.GetDatasource).Methods(http.MethodGet)
+	subrouter.HandleFunc("/{code}", controller.CreateDatasource).Methods(http.MethodPost)
+	subrouter.HandleFunc("/{code}", controller.UpdateDatasource).Methods(http.MethodPut)
+	subrouter.HandleFunc("/{code}", controller.DeleteDatasource).Methods(http.MethodDelete)
+}
+
+// 数据源错误对应的状态码
+func datasourceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, modules.ErrDatasourceNotFound):
+		return 404
+	case errors.Is(err, modules.ErrDatasourceDuplicated), errors.Is(err, modules.ErrDatasourceInUse):
+		return 409
+	case errors.Is(err, modules.ErrDatasourceNoCode), errors.Is(err, modules.ErrDatasourceNotSupport), errors.Is(err, modules.ErrDatasourceReserved):
+		return 400
+	}
+	return 500
 }
 
 // 获取数据源列表
@@ -37,3 +63,174 @@ func (controller DatasourceController) GetDatasources(w http.ResponseWriter, r *
 	w.Write(bytes)
 	w.WriteHeader(200)
 }
+
+// 获取数据源
+func (controller DatasourceController) GetDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	code := vars["code"]
+	datasource, err := controller.DatasourceService.GetDatasource(code)
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(datasource)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 获取引用数据源的监控列表
+func (controller DatasourceController) GetUsages(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	code := vars["code"]
+	_, err := controller.DatasourceService.GetDatasource(code)
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(controller.DatasourceService.GetUsages(code))
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 创建数据源
+func (controller DatasourceController) CreateDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	var new modules.Datasource
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(bytes, &new)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if strings.TrimSpace(new.Code) == "" {
+		new.Code = vars["code"]
+	}
+	err = controller.DatasourceService.CreateDatasource(&new)
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(201)
+	w.Write([]byte(new.Code))
+}
+
+// 更新数据源
+func (controller DatasourceController) UpdateDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	code := vars["code"]
+	var new modules.Datasource
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(bytes, &new)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = controller.DatasourceService.UpdateDatasource(code, &new)
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(code))
+}
+
+// 删除数据源
+func (controller DatasourceController) DeleteDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	code := vars["code"]
+	err := controller.DatasourceService.DeleteDatasource(code)
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(code))
+}
+
+// 获取连接测试超时时间，query参数timeout单位为秒
+func testTimeout(r *http.Request) time.Duration {
+	seconds, err := strconv.Atoi(r.URL.Query().Get("timeout"))
+	if err != nil || seconds <= 0 {
+		return services.DatasourceTestTimeout
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// 测试数据源连接
+func (controller DatasourceController) TestDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	code := vars["code"]
+	result, err := controller.DatasourceService.TestDatasource(code, testTimeout(r))
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 测试未保存的数据源连接
+func (controller DatasourceController) TestNewDatasource(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	var new modules.Datasource
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(bytes, &new)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	result, err := controller.DatasourceService.TestNewDatasource(&new, testTimeout(r))
+	if err != nil {
+		w.WriteHeader(datasourceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err = json.Marshal(result)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
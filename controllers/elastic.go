@@ -0,0 +1,38 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/services"
+
+	"github.com/gorilla/mux"
+)
+
+type ElasticController struct {
+	ElasticService *services.ElasticService
+}
+
+func NewElasticController(elasticService *services.ElasticService) *ElasticController {
+	return &ElasticController{
+		ElasticService: elasticService,
+	}
+}
+
+// 绑定Router
+func (controller ElasticController) BindRouter(base *mux.Router) {
+	subrouter := base.PathPrefix("/elastic").Subrouter()
+	subrouter.HandleFunc("/stats", controller.GetStats).Methods(http.MethodGet)
+}
+
+// 获取批量写入统计
+func (controller ElasticController) GetStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	stats := controller.ElasticService.GetStats()
+	bytes, err := json.Marshal(stats)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
@@ -0,0 +1,37 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+	"server/services"
+
+	"github.com/gorilla/mux"
+)
+
+type HealthController struct {
+	HealthService *services.HealthService
+}
+
+func NewHealthController(healthService *services.HealthService) *HealthController {
+	return &HealthController{
+		HealthService: healthService,
+	}
+}
+
+// 绑定Router
+func (controller HealthController) BindRouter(base *mux.Router) {
+	base.HandleFunc("/health", controller.GetHealth).Methods(http.MethodGet)
+}
+
+// 获取健康状态，依赖异常时仍返回200，由Status区分
+func (controller HealthController) GetHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	health := controller.HealthService.GetHealth()
+	bytes, err := json.Marshal(health)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"server/modules"
+	"server/services"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type SilenceController struct {
+	SilenceService *services.SilenceService
+}
+
+func NewSilenceController(silenceService *services.SilenceService) *SilenceController {
+	return &SilenceController{
+		SilenceService: silenceService,
+	}
+}
+
+// 绑定Router
+func (controller SilenceController) BindRouter(base *mux.Router) {
+	subrouter := base.PathPrefix("/silences").Subrouter()
+	subrouter.HandleFunc("", controller.GetSilences).Methods(http.MethodGet)
+	subrouter.HandleFunc("", controller.CreateSilence).Methods(http.MethodPost)
+	subrouter.HandleFunc("/{id}", controller.GetSilence).Methods(http.MethodGet)
+	subrouter.HandleFunc("/{id}", controller.UpdateSilence).Methods(http.MethodPut)
+	subrouter.HandleFunc("/{id}", controller.DeleteSilence).Methods(http.MethodDelete)
+}
+
+// 静默错误对应的状态码
+func silenceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, modules.ErrSilenceNotFound):
+		return 404
+	case errors.Is(err, modules.ErrSilenceInvalid):
+		return 400
+	}
+	return 500
+}
+
+// 获取静默列表，?active=true时仅返回当前生效的静默
+func (controller SilenceController) GetSilences(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	active, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+	bytes, err := json.Marshal(controller.SilenceService.GetSilences(active))
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 获取静默
+func (controller SilenceController) GetSilence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	silence, err := controller.SilenceService.GetSilence(vars["id"])
+	if err != nil {
+		w.WriteHeader(silenceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(silence)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 创建静默，返回编号
+func (controller SilenceController) CreateSilence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	var new modules.Silence
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(bytes, &new)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = controller.SilenceService.CreateSilence(&new)
+	if err != nil {
+		w.WriteHeader(silenceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.WriteHeader(201)
+	w.Write([]byte(new.ID))
+}
+
+// 更新静默
+func (controller SilenceController) UpdateSilence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	id := vars["id"]
+	var new modules.Silence
+	bytes, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = json.Unmarshal(bytes, &new)
+	if err != nil {
+		w.WriteHeader(400)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	err = controller.SilenceService.UpdateSilence(id, &new)
+	if err != nil {
+		w.WriteHeader(silenceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(id))
+}
+
+// 删除静默
+func (controller SilenceController) DeleteSilence(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	id := vars["id"]
+	err := controller.SilenceService.DeleteSilence(id)
+	if err != nil {
+		w.WriteHeader(silenceErrorStatus(err))
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write([]byte(id))
+}
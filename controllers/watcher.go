@@ -2,11 +2,13 @@ package controllers
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"server/modules"
 	"server/services"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -39,6 +41,27 @@ func (controller WatcherController) BindRouter(base *mux.Router) {
 	subrouter.HandleFunc("/{app}/start", controller.StartWatcher).Methods(http.MethodPatch)
 	subrouter.HandleFunc("/{app}/stop", controller.StopWatcher).Methods(http.MethodPatch)
 	subrouter.HandleFunc("/{app}/data-preview", controller.DataPreviewWatcher).Methods(http.MethodGet)
+	subrouter.HandleFunc("/{app}/run", controller.RunWatcher).Methods(http.MethodPatch)
+	subrouter.HandleFunc("/{app}/runs", controller.GetRuns).Methods(http.MethodGet)
+}
+
+// 监控错误对应的状态码
+func watcherErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, services.ErrWatcherNotFound), errors.Is(err, modules.ErrWatcherNotFound):
+		return 404
+	case errors.Is(err, modules.ErrDatasourceNotFound),
+		errors.Is(err, modules.ErrMappingInvalid),
+		errors.Is(err, modules.ErrWatcherRequestInvalid),
+		errors.Is(err, modules.ErrPatternInvalid),
+		errors.Is(err, modules.ErrBucketInvalid),
+		errors.Is(err, modules.ErrAlertRuleInvalid),
+		errors.Is(err, modules.ErrChannelNotFound),
+		errors.Is(err, modules.ErrSinkNotFound),
+		errors.Is(err, modules.ErrKafkaTopicInvalid):
+		return 400
+	}
+	return 500
 }
 
 // 获取监控列表
@@ -47,12 +70,11 @@ func (controller WatcherController) GetWatchers(w http.ResponseWriter, r *http.R
 	watchers := controller.WatcherService.GetWatchers()
 	bytes, err := json.Marshal(watchers)
 	if err != nil {
-		w.Write([]byte(err.Error()))
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	w.Write(bytes)
-	w.WriteHeader(200)
 }
 
 // 获取监控
@@ -62,12 +84,8 @@ func (controller WatcherController) GetWatcher(w http.ResponseWriter, r *http.Re
 	app := vars["app"]
 	watcher, err := controller.WatcherService.GetWatcher(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	bytes, _ := json.Marshal(watcher)
@@ -77,7 +95,6 @@ func (controller WatcherController) GetWatcher(w http.ResponseWriter, r *http.Re
 	// 	})
 	// }
 	w.Write(bytes)
-	w.WriteHeader(200)
 }
 
 // 创建监控
@@ -87,29 +104,25 @@ func (controller WatcherController) CreateWatcher(w http.ResponseWriter, r *http
 	bytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		// ES.NewError("Create watcher failed", err.Error(), nil)
-		w.Write([]byte(err.Error()))
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	err = json.Unmarshal(bytes, &new)
 	if err != nil {
 		// ES.NewError("Create watcher failed", err.Error(), nil)
+		w.WriteHeader(400)
 		w.Write([]byte(err.Error()))
-		w.WriteHeader(500)
 		return
 	}
 	err = controller.WatcherService.CreateWatcher(&new)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
-	w.Write([]byte(new.App))
 	w.WriteHeader(201)
+	w.Write([]byte(new.App))
 }
 
 // 更新监控
@@ -121,29 +134,24 @@ func (controller WatcherController) UpdateWatcher(w http.ResponseWriter, r *http
 	bytes, err := io.ReadAll(r.Body)
 	if err != nil {
 		// ES.NewError("Update watcher failed", err.Error(), nil)
-		w.Write([]byte(err.Error()))
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	err = json.Unmarshal(bytes, &new)
 	if err != nil {
 		// ES.NewError("Update watcher failed", err.Error(), nil)
+		w.WriteHeader(400)
 		w.Write([]byte(err.Error()))
-		w.WriteHeader(500)
 		return
 	}
 	err = controller.WatcherService.UpdateWatcher(app, &new)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	w.Write([]byte(new.App))
-	w.WriteHeader(200)
 }
 
 // 删除监控
@@ -153,16 +161,11 @@ func (controller WatcherController) DeleteWatcher(w http.ResponseWriter, r *http
 	app := vars["app"]
 	err := controller.WatcherService.DeleteWatcher(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	w.Write([]byte(app))
-	w.WriteHeader(200)
 }
 
 // 启用监控
@@ -172,16 +175,11 @@ func (controller WatcherController) EnableWatcher(w http.ResponseWriter, r *http
 	app := vars["app"]
 	err := controller.WatcherService.EnableWatcher(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	w.Write([]byte(app))
-	w.WriteHeader(200)
 }
 
 // 禁用监控
@@ -191,16 +189,11 @@ func (controller WatcherController) DisableWatcher(w http.ResponseWriter, r *htt
 	app := vars["app"]
 	err := controller.WatcherService.DisableWatcher(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	w.Write([]byte(app))
-	w.WriteHeader(200)
 }
 
 // 开始监控
@@ -210,16 +203,11 @@ func (controller WatcherController) StartWatcher(w http.ResponseWriter, r *http.
 	app := vars["app"]
 	id, err := controller.WatcherService.StartWatcher(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	w.Write([]byte(fmt.Sprintf("%d", id)))
-	w.WriteHeader(200)
 }
 
 // 停止监控
@@ -229,16 +217,11 @@ func (controller WatcherController) StopWatcher(w http.ResponseWriter, r *http.R
 	app := vars["app"]
 	err := controller.WatcherService.StopWatcher(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
-			w.WriteHeader(404)
-			return
-		}
-		w.WriteHeader(500)
 		return
 	}
 	w.Write([]byte(app))
-	w.WriteHeader(200)
 }
 
 // 监控数据预览
@@ -249,12 +232,12 @@ func (controller WatcherController) DataPreviewWatcher(w http.ResponseWriter, r
 	datasourceCode := r.URL.Query().Get("datasourceCode")
 	datas, err := controller.WatcherService.DataPreviewWatcher(app, datasourceCode)
 	if err != nil {
-		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound || err == modules.ErrDatasourceNotFound {
+		if errors.Is(err, modules.ErrDatasourceNotFound) {
 			w.WriteHeader(404)
-			return
+		} else {
+			w.WriteHeader(watcherErrorStatus(err))
 		}
-		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	buf, err := json.Marshal(datas)
@@ -263,7 +246,6 @@ func (controller WatcherController) DataPreviewWatcher(w http.ResponseWriter, r
 		return
 	}
 	w.Write(buf)
-	w.WriteHeader(200)
 }
 
 // 获取监控列表状态
@@ -273,19 +255,18 @@ func (controller WatcherController) GetEntries(w http.ResponseWriter, r *http.Re
 	apps := strings.Split(query.Get("apps"), ",")
 	entries, err := controller.WatcherService.GetEntries(apps)
 	if err != nil {
-		w.Write([]byte(err.Error()))
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	bytes, err := json.Marshal(entries)
 	if err != nil {
 		// ES.NewError("Get watcher entry failed", err.Error(), res)
-		w.Write([]byte(err.Error()))
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	w.Write(bytes)
-	w.WriteHeader(200)
 }
 
 // 获取监控状态
@@ -295,21 +276,81 @@ func (controller WatcherController) GetWatcherEntry(w http.ResponseWriter, r *ht
 	app := vars["app"]
 	entry, err := controller.WatcherService.GetWatcherEntry(app)
 	if err != nil {
+		w.WriteHeader(watcherErrorStatus(err))
 		w.Write([]byte(err.Error()))
-		if err == modules.ErrWatcherNotFound {
+		return
+	}
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		// ES.NewError("Get watcher entry failed", err.Error(), res)
+		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	w.Write(bytes)
+}
+
+// 立即运行监控
+func (controller WatcherController) RunWatcher(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	app := vars["app"]
+	run, err := controller.WatcherService.RunWatcher(app)
+	if err != nil {
+		if errors.Is(err, services.ErrWatcherNotFound) {
 			w.WriteHeader(404)
-			return
+		} else {
+			w.WriteHeader(500)
 		}
+		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(run)
+	if err != nil {
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
-	bytes, err := json.Marshal(entry)
+	w.Write(bytes)
+}
+
+// 获取分页参数，page从1开始，size默认20，最大500
+func pageParams(r *http.Request) (int, int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size <= 0 {
+		size = 20
+	}
+	if size > 500 {
+		size = 500
+	}
+	return page, size
+}
+
+// 分页获取监控运行记录
+func (controller WatcherController) GetRuns(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Content-Type", "application/json;charset=UTF-8")
+	vars := mux.Vars(r)
+	app := vars["app"]
+	page, size := pageParams(r)
+	runs, err := controller.WatcherService.GetRuns(app, page, size)
 	if err != nil {
-		// ES.NewError("Get watcher entry failed", err.Error(), res)
+		if errors.Is(err, services.ErrWatcherNotFound) {
+			w.WriteHeader(404)
+		} else {
+			w.WriteHeader(500)
+		}
 		w.Write([]byte(err.Error()))
+		return
+	}
+	bytes, err := json.Marshal(runs)
+	if err != nil {
 		w.WriteHeader(500)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	w.Write(bytes)
-	w.WriteHeader(200)
 }
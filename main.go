@@ -1,6 +1,7 @@
 package main
 
 import (
+	"log"
 	"net/http"
 	"os"
 	"server/controllers"
@@ -10,6 +11,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	_ "time/tzdata"
 )
@@ -29,20 +31,46 @@ func main() {
 	scheduler.Init()
 	elastic := conf.Elastic
 	elastic.Init()
-	// elasticService := services.NewElasticService(elastic)
-	datasourceService := services.NewDatasourceService(conf.Datasources)
-	schedulerService := services.NewSchedulerService(conf.Watchers, conf.Datasources, scheduler, elastic)
-	watcherService := services.NewWatcherService(conf, conf.Watchers, datasourceService, conf.Datasources, scheduler, elastic)
+	elasticService := services.NewElasticService(elastic)
+	history := conf.History
+	err := history.Init()
+	if err != nil {
+		log.Printf("Open run history failed: %v", err)
+	}
+	sinks := modules.NewSinkManager(conf.Sinks, elastic)
+	alerts := modules.NewAlertManager()
+	notifier := modules.NewNotifier(conf.Channels, conf.Watchers, conf.Silences, alerts, elastic)
+	alerts.OnChange(notifier.Notify)
+	alerts.OnChange(sinks.Notify)
+	datasourceService := services.NewDatasourceService(conf, conf.Datasources, conf.Watchers)
+	schedulerService := services.NewSchedulerService(conf.Watchers, conf.Datasources, scheduler, sinks, alerts, notifier, history)
+	watcherService := services.NewWatcherService(conf, conf.Watchers, datasourceService, conf.Datasources, scheduler, sinks, alerts, notifier, history)
+	alertService := services.NewAlertService(alerts)
+	channelService := services.NewChannelService(notifier)
+	silenceService := services.NewSilenceService(conf, conf.Silences)
+	silenceService.Start(scheduler.Cron)
+	healthService := services.NewHealthService(scheduler, elastic, history)
 	go func() {
 		schedulerService.Start()
 	}()
 	router := mux.NewRouter()
+	router.Handle("/metrics", promhttp.Handler())
 	apiRouter := router.PathPrefix("/api").Subrouter()
 	datasourceController := controllers.NewDatasourceController(datasourceService)
 	watcherController := controllers.NewWatcherController(watcherService, datasourceService)
 	schedulerController := controllers.NewSchedulerController(schedulerService)
+	alertController := controllers.NewAlertController(alertService)
+	channelController := controllers.NewChannelController(channelService)
+	silenceController := controllers.NewSilenceController(silenceService)
+	elasticController := controllers.NewElasticController(elasticService)
+	healthController := controllers.NewHealthController(healthService)
 	datasourceController.BindRouter(apiRouter)
 	watcherController.BindRouter(apiRouter)
 	schedulerController.BindRouter(apiRouter)
+	alertController.BindRouter(apiRouter)
+	channelController.BindRouter(apiRouter)
+	silenceController.BindRouter(apiRouter)
+	elasticController.BindRouter(apiRouter)
+	healthController.BindRouter(apiRouter)
 	http.ListenAndServe(":8080", router)
 }
@@ -0,0 +1,360 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrAlertRuleInvalid = errors.New("alert rule is invalid")
+
+var (
+	AlertSeverityInfo     = "info"
+	AlertSeverityWarning  = "warning"
+	AlertSeverityCritical = "critical"
+)
+
+var (
+	AlertStatePending  = "pending"
+	AlertStateFiring   = "firing"
+	AlertStateResolved = "resolved"
+)
+
+// 已恢复告警的保留时长，超过后从告警列表移除
+const AlertResolvedRetention = 24 * time.Hour
+
+// 告警规则
+type AlertRule struct {
+	Name     string `yaml:"Name"`             // 规则名称
+	Expr     string `yaml:"Expr"`             // 条件表达式，如Expire1Week > 0、Expire1Day >= 50 on source MA-103
+	Source   string `yaml:"Source,omitempty"` // 数据源编号，为空时匹配所有数据源，也可在表达式中以on source指定
+	Severity string `yaml:"Severity"`         // 级别（info/warning/critical）
+	For      string `yaml:"For,omitempty"`    // 持续时长，如5m，条件持续满足该时长后触发，为空时立即触发
+}
+
+// 告警条件
+type AlertCondition struct {
+	Field     string  // 字段，分段名称或Extend.xxx
+	Operator  string  // 比较符
+	Threshold float64 // 阈值
+	Source    string  // 数据源编号
+}
+
+var alertExprRegexp = regexp.MustCompile(`^\s*([\w.]+)\s*(>=|<=|==|!=|>|<)\s*(-?[\d.]+)\s*(?:on\s+source\s+(\S+))?\s*$`)
+
+// 解析条件表达式
+func (rule *AlertRule) Parse() (*AlertCondition, error) {
+	matches := alertExprRegexp.FindStringSubmatch(rule.Expr)
+	if matches == nil {
+		return nil, fmt.Errorf("%w: expr %s", ErrAlertRuleInvalid, rule.Expr)
+	}
+	threshold, err := strconv.ParseFloat(matches[3], 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: expr %s", ErrAlertRuleInvalid, rule.Expr)
+	}
+	condition := &AlertCondition{
+		Field:     matches[1],
+		Operator:  matches[2],
+		Threshold: threshold,
+		Source:    matches[4],
+	}
+	if rule.Source != "" {
+		condition.Source = rule.Source
+	}
+	return condition, nil
+}
+
+// 获取持续时长
+func (rule *AlertRule) GetFor() (time.Duration, error) {
+	if rule.For == "" {
+		return 0, nil
+	}
+	dur, err := ParseThreshold(rule.For)
+	if err != nil {
+		return 0, fmt.Errorf("%w: for %s", ErrAlertRuleInvalid, rule.For)
+	}
+	return dur, nil
+}
+
+// 校验告警规则
+func ValidateAlertRules(rules []AlertRule) error {
+	names := map[string]bool{}
+	for _, rule := range rules {
+		if strings.TrimSpace(rule.Name) == "" {
+			return fmt.Errorf("%w: rule has no name", ErrAlertRuleInvalid)
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("%w: rule %s is duplicated", ErrAlertRuleInvalid, rule.Name)
+		}
+		names[rule.Name] = true
+		switch rule.Severity {
+		case "", AlertSeverityInfo, AlertSeverityWarning, AlertSeverityCritical:
+		default:
+			return fmt.Errorf("%w: severity %s", ErrAlertRuleInvalid, rule.Severity)
+		}
+		_, err := rule.Parse()
+		if err != nil {
+			return err
+		}
+		_, err = rule.GetFor()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 是否满足条件
+func (condition *AlertCondition) Match(data *ExpiredData) (float64, bool) {
+	if condition.Source != "" && condition.Source != data.Datasource {
+		return 0, false
+	}
+	value, ok := data.GetValue(condition.Field)
+	if !ok {
+		return 0, false
+	}
+	switch condition.Operator {
+	case ">":
+		return value, value > condition.Threshold
+	case ">=":
+		return value, value >= condition.Threshold
+	case "<":
+		return value, value < condition.Threshold
+	case "<=":
+		return value, value <= condition.Threshold
+	case "==":
+		return value, value == condition.Threshold
+	case "!=":
+		return value, value != condition.Threshold
+	}
+	return value, false
+}
+
+// 获取数值字段，支持分段名称及Extend.xxx
+func (data *ExpiredData) GetValue(field string) (float64, bool) {
+	if path, ok := strings.CutPrefix(field, "Extend."); ok {
+		var val interface{} = data.Extend
+		for _, key := range strings.Split(path, ".") {
+			obj, ok := val.(map[string]interface{})
+			if !ok {
+				return 0, false
+			}
+			val = getField(obj, key)
+		}
+		switch v := val.(type) {
+		case float64:
+			return v, true
+		case nil:
+			return 0, false
+		}
+		return float64(parseInt(val)), true
+	}
+	if count, ok := data.Buckets[field]; ok {
+		return float64(count), true
+	}
+	switch field {
+	case BucketExpire1Day:
+		return float64(data.Expire1Day), true
+	case BucketExpire1Week:
+		return float64(data.Expire1Week), true
+	case BucketExpire1Month:
+		return float64(data.Expire1Month), true
+	}
+	return 0, false
+}
+
+// 告警
+type Alert struct {
+	App        string       // 应用名称
+	Rule       string       // 规则名称
+	Expr       string       // 条件表达式
+	Severity   string       // 级别
+	Datasource string       // 数据源编号
+	State      string       // 状态（pending/firing/resolved）
+	Value      float64      // 当前值
+	ActiveAt   time.Time    // 条件开始满足时间
+	FiredAt    time.Time    // 触发时间
+	ResolvedAt time.Time    // 恢复时间
+	UpdatedAt  time.Time    // 最后评估时间
+	Data       *ExpiredData `json:"-"` // 最近一次数据
+}
+
+// 告警状态变化事件
+type AlertEvent struct {
+	Alert   Alert          // 告警快照
+	Watcher *WatcherConfig // 监控配置
+	Data    *ExpiredData   // 触发数据
+}
+
+// 告警管理，维护告警状态机：条件满足进入pending，持续For时长后firing，条件不再满足后resolved
+type AlertManager struct {
+	Mutex     sync.Mutex               // 互斥锁
+	Alerts    map[string]*Alert        // 告警列表，键为App/Rule/Datasource
+	Listeners []func(event AlertEvent) // 状态变化（firing/resolved）监听
+}
+
+func NewAlertManager() *AlertManager {
+	return &AlertManager{
+		Alerts: map[string]*Alert{},
+	}
+}
+
+// 添加状态变化监听
+func (manager *AlertManager) OnChange(listener func(event AlertEvent)) {
+	manager.Mutex.Lock()
+	defer manager.Mutex.Unlock()
+	manager.Listeners = append(manager.Listeners, listener)
+}
+
+// 评估监控本次运行结果
+func (manager *AlertManager) Evaluate(watcher *WatcherConfig, datas []ExpiredData) {
+	if manager == nil || len(watcher.Alerts) == 0 {
+		return
+	}
+	now := time.Now().Local()
+	// 按数据源分组，保持数据源顺序
+	sources := make([]string, 0)
+	rowsBySource := map[string][]*ExpiredData{}
+	for i := range datas {
+		source := datas[i].Datasource
+		if _, ok := rowsBySource[source]; !ok {
+			sources = append(sources, source)
+		}
+		rowsBySource[source] = append(rowsBySource[source], &datas[i])
+	}
+	events := make([]AlertEvent, 0)
+	manager.Mutex.Lock()
+	manager.purge(now)
+	for _, rule := range watcher.Alerts {
+		condition, err := rule.Parse()
+		if err != nil {
+			continue
+		}
+		forDur, _ := rule.GetFor()
+		for _, source := range sources {
+			if condition.Source != "" && condition.Source != source {
+				continue
+			}
+			// 同一数据源返回多行时，任一行满足即视为满足，取首个满足的行，均不满足时取最后一行
+			var data *ExpiredData
+			var value float64
+			var matched bool
+			for _, data = range rowsBySource[source] {
+				value, matched = condition.Match(data)
+				if matched {
+					break
+				}
+			}
+			key := watcher.App + "/" + rule.Name + "/" + source
+			alert := manager.Alerts[key]
+			if matched {
+				if alert == nil || alert.State == AlertStateResolved {
+					alert = &Alert{
+						App:        watcher.App,
+						Rule:       rule.Name,
+						Expr:       rule.Expr,
+						Severity:   rule.Severity,
+						Datasource: source,
+						State:      AlertStatePending,
+						ActiveAt:   now,
+					}
+					manager.Alerts[key] = alert
+				}
+				alert.Value = value
+				alert.UpdatedAt = now
+				alert.Data = data
+				if alert.State == AlertStatePending && now.Sub(alert.ActiveAt) >= forDur {
+					alert.State = AlertStateFiring
+					alert.FiredAt = now
+					events = append(events, AlertEvent{Alert: *alert, Watcher: watcher, Data: data})
+				}
+				continue
+			}
+			if alert == nil {
+				continue
+			}
+			switch alert.State {
+			case AlertStatePending:
+				delete(manager.Alerts, key)
+			case AlertStateFiring:
+				alert.State = AlertStateResolved
+				alert.Value = value
+				alert.ResolvedAt = now
+				alert.UpdatedAt = now
+				alert.Data = data
+				events = append(events, AlertEvent{Alert: *alert, Watcher: watcher, Data: data})
+			}
+		}
+	}
+	listeners := manager.Listeners
+	manager.Mutex.Unlock()
+	for _, event := range events {
+		for _, listener := range listeners {
+			listener(event)
+		}
+	}
+}
+
+// 告警键
+func alertKey(app string, rule string, datasource string) string {
+	return app + "/" + rule + "/" + datasource
+}
+
+// 获取告警
+func (manager *AlertManager) GetAlert(app string, rule string, datasource string) (Alert, bool) {
+	manager.Mutex.Lock()
+	defer manager.Mutex.Unlock()
+	alert, ok := manager.Alerts[alertKey(app, rule, datasource)]
+	if !ok {
+		return Alert{}, false
+	}
+	return *alert, true
+}
+
+// 移除超过保留时长的已恢复告警
+func (manager *AlertManager) purge(now time.Time) {
+	for key, alert := range manager.Alerts {
+		if alert.State == AlertStateResolved && now.Sub(alert.ResolvedAt) > AlertResolvedRetention {
+			delete(manager.Alerts, key)
+		}
+	}
+}
+
+// 获取告警列表，all为false时仅返回pending及firing告警
+func (manager *AlertManager) GetAlerts(all bool) []Alert {
+	manager.Mutex.Lock()
+	defer manager.Mutex.Unlock()
+	list := make([]Alert, 0, len(manager.Alerts))
+	for _, alert := range manager.Alerts {
+		if !all && alert.State == AlertStateResolved {
+			continue
+		}
+		list = append(list, *alert)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].App != list[j].App {
+			return list[i].App < list[j].App
+		}
+		if list[i].Rule != list[j].Rule {
+			return list[i].Rule < list[j].Rule
+		}
+		return list[i].Datasource < list[j].Datasource
+	})
+	return list
+}
+
+// 移除监控的告警
+func (manager *AlertManager) Remove(app string) {
+	manager.Mutex.Lock()
+	defer manager.Mutex.Unlock()
+	for key, alert := range manager.Alerts {
+		if alert.App == app {
+			delete(manager.Alerts, key)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package modules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEvaluateMultipleRows(t *testing.T) {
+	manager := NewAlertManager()
+	events := make([]AlertEvent, 0)
+	manager.OnChange(func(event AlertEvent) {
+		events = append(events, event)
+	})
+	watcher := &WatcherConfig{
+		App:    "order",
+		Alerts: []AlertRule{{Name: "backlog", Expr: "Expire1Day > 5", Severity: AlertSeverityWarning}},
+	}
+	// 同一数据源多行，仅第一行满足条件
+	datas := []ExpiredData{
+		{Datasource: "A", Buckets: map[string]int{"Expire1Day": 8}},
+		{Datasource: "A", Buckets: map[string]int{"Expire1Day": 1}},
+		{Datasource: "B", Buckets: map[string]int{"Expire1Day": 2}},
+	}
+	manager.Evaluate(watcher, datas)
+	alerts := manager.GetAlerts(false)
+	if len(alerts) != 1 || alerts[0].Datasource != "A" || alerts[0].State != AlertStateFiring || alerts[0].Value != 8 {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+	// 行顺序变化不影响告警状态
+	manager.Evaluate(watcher, []ExpiredData{datas[1], datas[0], datas[2]})
+	if alerts := manager.GetAlerts(false); len(alerts) != 1 || alerts[0].State != AlertStateFiring || len(events) != 1 {
+		t.Fatalf("unexpected alerts %v, events %d", alerts, len(events))
+	}
+	manager.Evaluate(watcher, []ExpiredData{datas[1], datas[2]})
+	alerts = manager.GetAlerts(true)
+	if len(alerts) != 1 || alerts[0].State != AlertStateResolved || alerts[0].Value != 1 || len(events) != 2 {
+		t.Fatalf("unexpected alerts %v, events %d", alerts, len(events))
+	}
+}
+
+func TestPurgeResolvedAlerts(t *testing.T) {
+	manager := NewAlertManager()
+	now := time.Now()
+	manager.Alerts["order/backlog/A"] = &Alert{State: AlertStateResolved, ResolvedAt: now.Add(-AlertResolvedRetention - time.Minute)}
+	manager.Alerts["order/backlog/B"] = &Alert{State: AlertStateResolved, ResolvedAt: now.Add(-time.Hour)}
+	manager.Alerts["order/backlog/C"] = &Alert{State: AlertStateFiring, FiredAt: now.Add(-48 * time.Hour)}
+	manager.purge(now)
+	if _, ok := manager.Alerts["order/backlog/A"]; ok || len(manager.Alerts) != 2 {
+		t.Errorf("unexpected alerts %v", manager.Alerts)
+	}
+}
@@ -0,0 +1,208 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"text/template"
+	"time"
+)
+
+var (
+	APIAuthTypeBasic  = "basic"
+	APIAuthTypeBearer = "bearer"
+	APIAuthTypeAPIKey = "apikey"
+)
+
+var (
+	APIKeyInHeader = "header"
+	APIKeyInQuery  = "query"
+)
+
+// api请求默认超时时间
+const APIDefaultTimeout = 30 * time.Second
+
+// api请求体模板数据
+type APIRequestData struct {
+	Watcher    *WatcherConfig // 监控配置
+	Datasource *Datasource    // 数据源
+	Now        time.Time      // 请求时间
+}
+
+// 校验api数据源配置
+func (datasource *Datasource) validateAPI() error {
+	if datasource.Url == "" {
+		return fmt.Errorf("%w: api datasource has no url", ErrDatasourceNotSupport)
+	}
+	switch strings.ToLower(datasource.AuthType) {
+	case "", APIAuthTypeBasic, APIAuthTypeBearer, APIAuthTypeAPIKey:
+	default:
+		return fmt.Errorf("%w: auth type %s", ErrDatasourceNotSupport, datasource.AuthType)
+	}
+	switch strings.ToLower(datasource.APIKeyIn) {
+	case "", APIKeyInHeader, APIKeyInQuery:
+	default:
+		return fmt.Errorf("%w: api key in %s", ErrDatasourceNotSupport, datasource.APIKeyIn)
+	}
+	if datasource.Retries < 0 {
+		return fmt.Errorf("%w: retries %d", ErrDatasourceNotSupport, datasource.Retries)
+	}
+	if datasource.Body != "" {
+		_, err := template.New(datasource.Code).Parse(datasource.Body)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrDatasourceNotSupport, err.Error())
+		}
+	}
+	return nil
+}
+
+// 校验监控配置的请求体模板
+func (watcher *WatcherConfig) ValidateRequest() error {
+	if watcher.Request == "" {
+		return nil
+	}
+	_, err := template.New(watcher.App).Parse(watcher.Request)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrWatcherRequestInvalid, err)
+	}
+	return nil
+}
+
+// 生成api请求，soap数据源默认POST并附带SOAPAction请求头
+func (datasource *Datasource) NewRequest(ctx context.Context, data *APIRequestData) (*http.Request, error) {
+	soap := datasource.Type == DatasourceTypeSOAP
+	method := strings.ToUpper(datasource.Method)
+	if method == "" {
+		method = http.MethodGet
+		if soap {
+			method = http.MethodPost
+		}
+	}
+	rawUrl := datasource.Url
+	if soap {
+		// 可直接使用wsdl地址
+		rawUrl = strings.TrimSuffix(strings.TrimSuffix(rawUrl, "?wsdl"), "?WSDL")
+	}
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, &datasourceConfigError{err}
+	}
+	// 监控配置的请求体模板优先
+	bodyTemplate := datasource.Body
+	if data.Watcher != nil && data.Watcher.Request != "" {
+		bodyTemplate = data.Watcher.Request
+	}
+	var body io.Reader
+	if bodyTemplate != "" {
+		tmpl, err := template.New(datasource.Code).Parse(bodyTemplate)
+		if err != nil {
+			return nil, &datasourceConfigError{err}
+		}
+		var buf bytes.Buffer
+		err = tmpl.Execute(&buf, data)
+		if err != nil {
+			return nil, &datasourceConfigError{err}
+		}
+		body = &buf
+	}
+	authType := strings.ToLower(datasource.AuthType)
+	if authType == APIAuthTypeAPIKey && strings.ToLower(datasource.APIKeyIn) == APIKeyInQuery {
+		query := u.Query()
+		query.Set(datasource.getAPIKeyName(), datasource.Token)
+		u.RawQuery = query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, &datasourceConfigError{err}
+	}
+	if soap {
+		req.Header.Set("Content-Type", "text/xml;charset=UTF-8")
+		action := datasource.SOAPAction
+		if data.Watcher != nil && data.Watcher.SOAPAction != "" {
+			action = data.Watcher.SOAPAction
+		}
+		req.Header.Set("SOAPAction", `"`+action+`"`)
+	} else if body != nil {
+		req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+	}
+	for key, val := range datasource.Headers {
+		req.Header.Set(key, val)
+	}
+	switch authType {
+	case APIAuthTypeBasic:
+		req.SetBasicAuth(datasource.Username, datasource.Password)
+	case APIAuthTypeBearer:
+		req.Header.Set("Authorization", "Bearer "+datasource.Token)
+	case APIAuthTypeAPIKey:
+		if strings.ToLower(datasource.APIKeyIn) != APIKeyInQuery {
+			req.Header.Set(datasource.getAPIKeyName(), datasource.Token)
+		}
+	}
+	return req, nil
+}
+
+func (datasource *Datasource) getAPIKeyName() string {
+	if datasource.APIKeyName == "" {
+		return "X-API-Key"
+	}
+	return datasource.APIKeyName
+}
+
+// 获取请求超时时间
+func (datasource *Datasource) getTimeout() time.Duration {
+	if datasource.Timeout <= 0 {
+		return APIDefaultTimeout
+	}
+	return time.Duration(datasource.Timeout) * time.Second
+}
+
+// 发起api请求，5xx响应按配置次数重试，非2xx响应返回错误
+func (datasource *Datasource) Request(ctx context.Context, data *APIRequestData) (*http.Response, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, datasource.getTimeout())
+	defer cancel()
+	var resp *http.Response
+	var body []byte
+	var err error
+	for attempt := 0; attempt <= max(datasource.Retries, 0); attempt++ {
+		if attempt > 0 {
+			// 退避等待，500ms、1s、2s...
+			select {
+			case <-ctx.Done():
+				return resp, body, ctx.Err()
+			case <-time.After(time.Duration(250<<attempt) * time.Millisecond):
+			}
+		}
+		resp, body, err = datasource.request(ctx, data)
+		var httpErr *datasourceHTTPError
+		if err == nil || !errors.As(err, &httpErr) || httpErr.StatusCode < 500 {
+			break
+		}
+	}
+	return resp, body, err
+}
+
+// 发起单次api请求
+func (datasource *Datasource) request(ctx context.Context, data *APIRequestData) (*http.Response, []byte, error) {
+	req, err := datasource.NewRequest(ctx, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp, nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, body, &datasourceHTTPError{resp.StatusCode}
+	}
+	return resp, body, nil
+}
@@ -0,0 +1,232 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// 机器人消息默认标题模板
+const DefaultBotTitle = `{{if eq .Status "resolved"}}[恢复]{{else if eq .Status "test"}}[测试]{{else}}[告警]{{end}} {{.App}} {{.Rule}}`
+
+// 机器人消息默认markdown模板，可引用Notification字段及.Watcher（WatcherConfig）、.Data（ExpiredData）
+const DefaultBotTemplate = `### {{if eq .Status "resolved"}}[恢复]{{else if eq .Status "test"}}[测试]{{else}}[告警]{{end}} {{.App}}
+- 描述：{{.Desc}}
+- 模块：{{.Module}} / {{.System}}
+- 提供方：{{.Provider}}，请求方：{{.Requester}}
+- 数据源：{{.Datasource}}
+- 规则：{{.Rule}}（{{.Severity}}）{{.Expr}}，当前值：{{.Value}}
+{{range $name, $count := .Buckets}}- {{$name}}：{{$count}}
+{{end}}- 时间：{{.TimeStamp.Format "2006-01-02 15:04:05"}}`
+
+// 获取标题及正文模板
+func (channel *Channel) getTemplates() (*template.Template, *template.Template, error) {
+	title := channel.Title
+	if title == "" {
+		title = DefaultBotTitle
+	}
+	text := channel.Template
+	if text == "" {
+		text = DefaultBotTemplate
+	}
+	titleTmpl, err := template.New(channel.Name + ".title").Parse(title)
+	if err != nil {
+		return nil, nil, err
+	}
+	textTmpl, err := template.New(channel.Name).Parse(text)
+	if err != nil {
+		return nil, nil, err
+	}
+	return titleTmpl, textTmpl, nil
+}
+
+// 渲染消息标题及正文
+func (channel *Channel) render(notification *Notification) (string, string, error) {
+	titleTmpl, textTmpl, err := channel.getTemplates()
+	if err != nil {
+		return "", "", err
+	}
+	var title, text bytes.Buffer
+	err = titleTmpl.Execute(&title, notification)
+	if err != nil {
+		return "", "", err
+	}
+	err = textTmpl.Execute(&text, notification)
+	if err != nil {
+		return "", "", err
+	}
+	return title.String(), text.String(), nil
+}
+
+// 发送json消息
+func (channel *Channel) postJSON(ctx context.Context, rawUrl func() (string, error), message func() interface{}, check func(body []byte) error) error {
+	return channel.post(ctx, func(ctx context.Context) (*http.Request, error) {
+		// 签名含时间戳，每次重试重新生成
+		u, err := rawUrl()
+		if err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(message())
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+		for key, val := range channel.Headers {
+			req.Header.Set(key, val)
+		}
+		return req, nil
+	}, check)
+}
+
+// 校验钉钉、企业微信返回的errcode
+func checkErrCode(body []byte) error {
+	var res struct {
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	err := json.Unmarshal(body, &res)
+	if err != nil {
+		return &channelAPIError{-1, "invalid response " + string(body)}
+	}
+	if res.ErrCode != 0 {
+		return &channelAPIError{res.ErrCode, res.ErrMsg}
+	}
+	return nil
+}
+
+// 钉钉加签，HMAC-SHA256(secret, timestamp + "\n" + secret)的base64
+func SignDingTalk(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 发送钉钉机器人markdown消息，配置密钥时在地址上附加timestamp及sign
+func (channel *Channel) sendDingTalk(ctx context.Context, notification *Notification) error {
+	title, text, err := channel.render(notification)
+	if err != nil {
+		return err
+	}
+	rawUrl := func() (string, error) {
+		if channel.Secret == "" {
+			return channel.Url, nil
+		}
+		u, err := url.Parse(channel.Url)
+		if err != nil {
+			return "", err
+		}
+		timestamp := strconv.FormatInt(time.Now().UnixMilli(), 10)
+		query := u.Query()
+		query.Set("timestamp", timestamp)
+		query.Set("sign", SignDingTalk(channel.Secret, timestamp))
+		u.RawQuery = query.Encode()
+		return u.String(), nil
+	}
+	message := func() interface{} {
+		return map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"title": title,
+				"text":  text,
+			},
+		}
+	}
+	return channel.postJSON(ctx, rawUrl, message, checkErrCode)
+}
+
+// 发送企业微信机器人markdown消息，密钥包含在webhook地址的key参数中
+func (channel *Channel) sendWeCom(ctx context.Context, notification *Notification) error {
+	_, text, err := channel.render(notification)
+	if err != nil {
+		return err
+	}
+	rawUrl := func() (string, error) {
+		return channel.Url, nil
+	}
+	message := func() interface{} {
+		return map[string]interface{}{
+			"msgtype": "markdown",
+			"markdown": map[string]string{
+				"content": text,
+			},
+		}
+	}
+	return channel.postJSON(ctx, rawUrl, message, checkErrCode)
+}
+
+// 飞书签名，以timestamp + "\n" + secret为密钥对空串做HMAC-SHA256后base64
+func SignFeishu(secret string, timestamp string) string {
+	mac := hmac.New(sha256.New, []byte(timestamp+"\n"+secret))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// 发送飞书机器人消息卡片，配置密钥时在消息体中附加timestamp及sign
+func (channel *Channel) sendFeishu(ctx context.Context, notification *Notification) error {
+	title, text, err := channel.render(notification)
+	if err != nil {
+		return err
+	}
+	color := "red"
+	switch notification.Status {
+	case AlertStateResolved:
+		color = "green"
+	case NotificationStatusTest:
+		color = "blue"
+	}
+	rawUrl := func() (string, error) {
+		return channel.Url, nil
+	}
+	message := func() interface{} {
+		message := map[string]interface{}{
+			"msg_type": "interactive",
+			"card": map[string]interface{}{
+				"header": map[string]interface{}{
+					"title": map[string]string{
+						"tag":     "plain_text",
+						"content": title,
+					},
+					"template": color,
+				},
+				"elements": []map[string]string{
+					{
+						"tag":     "markdown",
+						"content": text,
+					},
+				},
+			},
+		}
+		if channel.Secret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			message["timestamp"] = timestamp
+			message["sign"] = SignFeishu(channel.Secret, timestamp)
+		}
+		return message
+	}
+	check := func(body []byte) error {
+		var res struct {
+			Code int    `json:"code"`
+			Msg  string `json:"msg"`
+		}
+		err := json.Unmarshal(body, &res)
+		if err != nil {
+			return &channelAPIError{-1, "invalid response " + string(body)}
+		}
+		if res.Code != 0 {
+			return &channelAPIError{res.Code, res.Msg}
+		}
+		return nil
+	}
+	return channel.postJSON(ctx, rawUrl, message, check)
+}
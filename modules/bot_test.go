@@ -0,0 +1,148 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 签名期望值由独立实现（python hmac）计算
+func TestSignDingTalk(t *testing.T) {
+	sign := SignDingTalk("SEC123", "1700000000000")
+	if sign != "lkcPI1uoxBY1gUnCnnPH1Kkru0Hqjo7rFpA3haIVhEQ=" {
+		t.Errorf("unexpected dingtalk sign %s", sign)
+	}
+}
+
+func TestSignFeishu(t *testing.T) {
+	sign := SignFeishu("SEC123", "1700000000")
+	if sign != "j/tImR0k8vYXRsYw0+GHVQkV1v/J/8obOuMU7PE/KDo=" {
+		t.Errorf("unexpected feishu sign %s", sign)
+	}
+}
+
+// 机器人请求记录
+type botRequest struct {
+	Query url.Values
+	Body  map[string]interface{}
+}
+
+// 启动模拟机器人服务，记录请求并返回response
+func newBotServer(t *testing.T, response string) (*httptest.Server, *[]botRequest) {
+	t.Helper()
+	requests := make([]botRequest, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		var message map[string]interface{}
+		err := json.Unmarshal(body, &message)
+		if err != nil {
+			t.Errorf("invalid body %s", body)
+		}
+		requests = append(requests, botRequest{Query: r.URL.Query(), Body: message})
+		w.Write([]byte(response))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newBotNotification() *Notification {
+	return &Notification{
+		Status:     AlertStateFiring,
+		Rule:       "backlog",
+		Expr:       "Expire1Day > 5",
+		Severity:   AlertSeverityWarning,
+		Value:      8,
+		App:        "order",
+		Datasource: "MA-103",
+		TimeStamp:  time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local),
+	}
+}
+
+func TestSendDingTalk(t *testing.T) {
+	server, requests := newBotServer(t, `{"errcode":0,"errmsg":"ok"}`)
+	channel := &Channel{Name: "ding", Type: ChannelTypeDingTalk, Url: server.URL + "/robot/send?access_token=abc", Secret: "SEC123"}
+	err := channel.Send(context.Background(), newBotNotification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("unexpected requests %d", len(*requests))
+	}
+	req := (*requests)[0]
+	timestamp := req.Query.Get("timestamp")
+	if req.Query.Get("access_token") != "abc" || timestamp == "" || req.Query.Get("sign") != SignDingTalk("SEC123", timestamp) {
+		t.Errorf("unexpected query %v", req.Query)
+	}
+	markdown, _ := req.Body["markdown"].(map[string]interface{})
+	if req.Body["msgtype"] != "markdown" || markdown["title"] != "[告警] order backlog" {
+		t.Errorf("unexpected body %v", req.Body)
+	}
+	if text, _ := markdown["text"].(string); !strings.Contains(text, "当前值：8") || !strings.Contains(text, "2024-01-02 03:04:05") {
+		t.Errorf("unexpected text %s", text)
+	}
+}
+
+func TestSendDingTalkError(t *testing.T) {
+	server, requests := newBotServer(t, `{"errcode":310000,"errmsg":"sign not match"}`)
+	channel := &Channel{Name: "ding", Type: ChannelTypeDingTalk, Url: server.URL, Secret: "SEC123"}
+	err := channel.Send(context.Background(), newBotNotification())
+	if err == nil || !strings.Contains(err.Error(), "sign not match") {
+		t.Errorf("unexpected error %v", err)
+	}
+	// 接口错误不重试
+	if len(*requests) != 1 {
+		t.Errorf("unexpected requests %d", len(*requests))
+	}
+}
+
+func TestSendWeCom(t *testing.T) {
+	server, requests := newBotServer(t, `{"errcode":0,"errmsg":"ok"}`)
+	channel := &Channel{Name: "wecom", Type: ChannelTypeWeCom, Url: server.URL + "/cgi-bin/webhook/send?key=abc"}
+	err := channel.Send(context.Background(), newBotNotification())
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := (*requests)[0]
+	if req.Query.Get("key") != "abc" || req.Query.Has("sign") {
+		t.Errorf("unexpected query %v", req.Query)
+	}
+	markdown, _ := req.Body["markdown"].(map[string]interface{})
+	if text, _ := markdown["content"].(string); req.Body["msgtype"] != "markdown" || !strings.HasPrefix(text, "### [告警] order") {
+		t.Errorf("unexpected body %v", req.Body)
+	}
+}
+
+func TestSendFeishu(t *testing.T) {
+	server, requests := newBotServer(t, `{"code":0,"msg":"success"}`)
+	channel := &Channel{Name: "feishu", Type: ChannelTypeFeishu, Url: server.URL + "/open-apis/bot/v2/hook/abc", Secret: "SEC123"}
+	notification := newBotNotification()
+	notification.Status = AlertStateResolved
+	err := channel.Send(context.Background(), notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := (*requests)[0]
+	timestamp, _ := req.Body["timestamp"].(string)
+	if timestamp == "" || req.Body["sign"] != SignFeishu("SEC123", timestamp) {
+		t.Errorf("unexpected sign %v %v", req.Body["timestamp"], req.Body["sign"])
+	}
+	card, _ := req.Body["card"].(map[string]interface{})
+	header, _ := card["header"].(map[string]interface{})
+	title, _ := header["title"].(map[string]interface{})
+	if req.Body["msg_type"] != "interactive" || header["template"] != "green" || title["content"] != "[恢复] order backlog" {
+		t.Errorf("unexpected card %v", card)
+	}
+	elements, _ := card["elements"].([]interface{})
+	if len(elements) != 1 {
+		t.Fatalf("unexpected elements %v", elements)
+	}
+	if element, _ := elements[0].(map[string]interface{}); element["tag"] != "markdown" || !strings.Contains(element["content"].(string), "MA-103") {
+		t.Errorf("unexpected element %v", element)
+	}
+}
@@ -0,0 +1,135 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	BucketExpire1Day   = "Expire1Day"
+	BucketExpire1Week  = "Expire1Week"
+	BucketExpire1Month = "Expire1Month"
+)
+
+var ErrBucketInvalid = errors.New("bucket is invalid")
+
+// 滞留时长分段
+type Bucket struct {
+	Name      string `yaml:"Name"`      // 名称，对应查询列名或api字段名
+	Threshold string `yaml:"Threshold"` // 滞留时长下限，如15m、4h、7d
+}
+
+// 默认分段，与原有Expire1Day/Expire1Week/Expire1Month字段一致
+var DefaultBuckets = []Bucket{
+	{Name: BucketExpire1Day, Threshold: "1d"},
+	{Name: BucketExpire1Week, Threshold: "7d"},
+	{Name: BucketExpire1Month, Threshold: "32d"},
+}
+
+// 解析阈值，在time.ParseDuration基础上支持d（天）
+func ParseThreshold(threshold string) (time.Duration, error) {
+	threshold = strings.TrimSpace(threshold)
+	if days, ok := strings.CutSuffix(threshold, "d"); ok {
+		n, err := strconv.ParseFloat(days, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: threshold %s", ErrBucketInvalid, threshold)
+		}
+		return time.Duration(n * float64(24*time.Hour)), nil
+	}
+	dur, err := time.ParseDuration(threshold)
+	if err != nil {
+		return 0, fmt.Errorf("%w: threshold %s", ErrBucketInvalid, threshold)
+	}
+	return dur, nil
+}
+
+// 校验分段配置
+func ValidateBuckets(buckets []Bucket) error {
+	names := map[string]bool{}
+	for _, bucket := range buckets {
+		if strings.TrimSpace(bucket.Name) == "" {
+			return fmt.Errorf("%w: bucket has no name", ErrBucketInvalid)
+		}
+		if names[bucket.Name] {
+			return fmt.Errorf("%w: bucket %s is duplicated", ErrBucketInvalid, bucket.Name)
+		}
+		names[bucket.Name] = true
+		_, err := ParseThreshold(bucket.Threshold)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 获取分段配置，未配置时使用默认分段
+func (watcher *WatcherConfig) GetBuckets() []Bucket {
+	if len(watcher.Buckets) == 0 {
+		return DefaultBuckets
+	}
+	return watcher.Buckets
+}
+
+// 分段阈值
+type BucketThreshold struct {
+	Name     string        // 分段名称
+	Duration time.Duration // 滞留时长下限
+}
+
+// 分段阈值列表，按时长降序排列
+type BucketThresholds []BucketThreshold
+
+// 获取分段阈值
+func (watcher *WatcherConfig) GetBucketThresholds() BucketThresholds {
+	buckets := watcher.GetBuckets()
+	thresholds := make(BucketThresholds, 0, len(buckets))
+	for _, bucket := range buckets {
+		dur, err := ParseThreshold(bucket.Threshold)
+		if err != nil {
+			continue
+		}
+		thresholds = append(thresholds, BucketThreshold{bucket.Name, dur})
+	}
+	sort.Slice(thresholds, func(i, j int) bool {
+		return thresholds[i].Duration > thresholds[j].Duration
+	})
+	return thresholds
+}
+
+// 按滞留时长获取所属分段，未达到任何阈值时返回空
+func (thresholds BucketThresholds) BucketOf(age time.Duration) string {
+	for _, threshold := range thresholds {
+		if age >= threshold.Duration {
+			return threshold.Name
+		}
+	}
+	return ""
+}
+
+// 补全分段数量，兼容原有Expire1Day/Expire1Week/Expire1Month字段
+func (data *ExpiredData) FillBuckets(buckets []Bucket) {
+	if data.Buckets == nil {
+		data.Buckets = map[string]int{}
+		for name, count := range map[string]int{
+			BucketExpire1Day:   data.Expire1Day,
+			BucketExpire1Week:  data.Expire1Week,
+			BucketExpire1Month: data.Expire1Month,
+		} {
+			if count != 0 {
+				data.Buckets[name] = count
+			}
+		}
+	}
+	for _, bucket := range buckets {
+		if _, ok := data.Buckets[bucket.Name]; !ok {
+			data.Buckets[bucket.Name] = 0
+		}
+	}
+	data.Expire1Day = data.Buckets[BucketExpire1Day]
+	data.Expire1Week = data.Buckets[BucketExpire1Week]
+	data.Expire1Month = data.Buckets[BucketExpire1Month]
+}
@@ -0,0 +1,372 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var (
+	ErrElasticQueueFull    = errors.New("elastic queue is full")
+	ErrElasticNotConnected = errors.New("elastic is not connected")
+)
+
+// 批量写入默认条数
+const ElasticDefaultBatchSize = 500
+
+// 批量写入默认间隔
+const ElasticDefaultFlushInterval = 5 * time.Second
+
+// 写入队列默认容量
+const ElasticDefaultQueueSize = 10000
+
+// 写入失败默认重试次数
+const ElasticDefaultRetries = 3
+
+// 批量写入请求超时时间
+const ElasticBulkTimeout = 30 * time.Second
+
+// 批量写入统计
+type ElasticStats struct {
+	QueueSize   int       // 队列容量
+	Queued      int       // 队列中待写入文档数
+	Indexed     int64     // 写入成功文档数
+	Failed      int64     // 写入失败文档数
+	Dropped     int64     // 队列或落盘已满被丢弃文档数
+	Retried     int64     // 重试文档数
+	Batches     int64     // 批量请求次数
+	LastFlush   time.Time // 最近一次写入时间
+	LastError   string    // 最近一次错误
+	LastErrorAt time.Time // 最近一次错误时间
+	Spooled     int       // 落盘待回放文档数
+	SpoolBytes  int64     // 落盘待回放字节数
+	SpoolOldest time.Time // 落盘最早文档入队时间
+	SpoolAge    int64     // 落盘最早文档等待时长(s)
+}
+
+// 待写入文档
+type bulkDoc struct {
+	index string
+	body  []byte
+	at    time.Time
+}
+
+// 批量写入器，按条数或间隔通过_bulk接口写入，Elasticsearch不可用时落盘，恢复后按顺序回放
+type bulkIndexer struct {
+	elastic *Elastic
+	queue   chan *bulkDoc
+	spool   *elasticSpool
+	mutex   sync.Mutex
+	stats   ElasticStats
+}
+
+func newBulkIndexer(elastic *Elastic) *bulkIndexer {
+	size := elastic.QueueSize
+	if size <= 0 {
+		size = ElasticDefaultQueueSize
+	}
+	spool, err := openSpool(elastic.getSpoolPath(), elastic.getSpoolSize())
+	if err != nil {
+		log.Printf("Open elastic spool failed: %v", err)
+	}
+	return &bulkIndexer{
+		elastic: elastic,
+		queue:   make(chan *bulkDoc, size),
+		spool:   spool,
+		stats: ElasticStats{
+			QueueSize: size,
+		},
+	}
+}
+
+func (conf *Elastic) getBatchSize() int {
+	if conf.BatchSize <= 0 {
+		return ElasticDefaultBatchSize
+	}
+	return conf.BatchSize
+}
+
+func (conf *Elastic) getFlushInterval() time.Duration {
+	if conf.FlushInterval <= 0 {
+		return ElasticDefaultFlushInterval
+	}
+	return time.Duration(conf.FlushInterval) * time.Second
+}
+
+func (conf *Elastic) getRefresh() string {
+	switch conf.Refresh {
+	case "true", "wait_for":
+		return conf.Refresh
+	}
+	return "false"
+}
+
+func (conf *Elastic) getRetries() int {
+	if conf.Retries == nil {
+		return ElasticDefaultRetries
+	}
+	return *conf.Retries
+}
+
+// 加入写入队列，队列满时直接丢弃，不阻塞写入方
+func (indexer *bulkIndexer) add(index string, body []byte) error {
+	select {
+	case indexer.queue <- &bulkDoc{index, body, time.Now()}:
+		return nil
+	default:
+	}
+	metricElasticFailures.Inc()
+	indexer.mutex.Lock()
+	indexer.stats.Dropped++
+	indexer.mutex.Unlock()
+	return ErrElasticQueueFull
+}
+
+// 从队列读取文档，达到批量条数或间隔时写入
+func (indexer *bulkIndexer) run() {
+	size := indexer.elastic.getBatchSize()
+	ticker := time.NewTicker(indexer.elastic.getFlushInterval())
+	defer ticker.Stop()
+	batch := make([]*bulkDoc, 0, size)
+	for {
+		select {
+		case doc := <-indexer.queue:
+			batch = append(batch, doc)
+			if len(batch) < size {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		indexer.flush(batch)
+		batch = make([]*bulkDoc, 0, size)
+	}
+}
+
+// 批量写入，429及5xx失败的文档按配置次数退避重试，仍失败时落盘
+func (indexer *bulkIndexer) flush(docs []*bulkDoc) {
+	// 连接异常或落盘中有待回放文档时追加到末尾，保持写入顺序
+	if indexer.spool != nil && (indexer.elastic.isDown() || indexer.spool.depth() > 0) {
+		indexer.spill(docs)
+		return
+	}
+	retries := indexer.elastic.getRetries()
+	pending := docs
+	var err error
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			indexer.mutex.Lock()
+			indexer.stats.Retried += int64(len(pending))
+			indexer.mutex.Unlock()
+			time.Sleep(time.Duration(500<<(attempt-1)) * time.Millisecond)
+		}
+		pending, err = indexer.send(pending)
+		if err != nil {
+			indexer.fail(0, err)
+		}
+		if attempt >= retries {
+			break
+		}
+	}
+	if len(pending) == 0 {
+		return
+	}
+	if indexer.spool != nil {
+		indexer.spill(pending)
+		return
+	}
+	indexer.fail(len(pending), fmt.Errorf("give up %d documents after %d retries", len(pending), retries))
+}
+
+// 写入落盘，超出容量的文档丢弃
+func (indexer *bulkIndexer) spill(docs []*bulkDoc) {
+	n, err := indexer.spool.append(docs)
+	if err == nil {
+		return
+	}
+	dropped := len(docs) - n
+	metricElasticFailures.Add(float64(dropped))
+	log.Printf("Spool %d documents failed: %v", dropped, err)
+	indexer.mutex.Lock()
+	defer indexer.mutex.Unlock()
+	indexer.stats.Dropped += int64(dropped)
+	indexer.stats.LastError = err.Error()
+	indexer.stats.LastErrorAt = time.Now().Local()
+}
+
+// 按顺序回放落盘文档，首批文档全部写入或被永久拒绝后才推进回放位置
+func (indexer *bulkIndexer) replay() {
+	size := indexer.elastic.getBatchSize()
+	interval := indexer.elastic.getFlushInterval()
+	for {
+		if indexer.elastic.isDown() {
+			time.Sleep(interval)
+			continue
+		}
+		docs, consumed, lines, err := indexer.spool.peek(size)
+		if err != nil {
+			indexer.fail(0, fmt.Errorf("read spool: %w", err))
+			time.Sleep(interval)
+			continue
+		}
+		if consumed == 0 {
+			time.Sleep(interval)
+			continue
+		}
+		indexer.replayBatch(docs)
+		err = indexer.spool.commit(consumed, lines)
+		if err != nil {
+			log.Printf("Commit spool failed: %v", err)
+		}
+	}
+}
+
+// 回放一批文档，可重试的文档原位退避重试，已写入的文档不重复发送
+func (indexer *bulkIndexer) replayBatch(docs []*bulkDoc) {
+	interval := indexer.elastic.getFlushInterval()
+	pending := docs
+	for attempt := 0; len(pending) > 0; attempt++ {
+		if attempt > 0 {
+			// 退避等待，1s、2s、4s...，最长为写入间隔
+			backoff := time.Duration(500<<min(attempt, 16)) * time.Millisecond
+			time.Sleep(min(backoff, interval))
+			if indexer.elastic.isDown() {
+				continue
+			}
+			indexer.mutex.Lock()
+			indexer.stats.Retried += int64(len(pending))
+			indexer.mutex.Unlock()
+		}
+		retry, err := indexer.send(pending)
+		if err != nil {
+			indexer.fail(0, err)
+		}
+		pending = retry
+	}
+}
+
+// 记录写入失败
+func (indexer *bulkIndexer) fail(count int, err error) {
+	metricElasticFailures.Add(float64(count))
+	log.Printf("Bulk index failed: %v", err)
+	indexer.mutex.Lock()
+	defer indexer.mutex.Unlock()
+	indexer.stats.Failed += int64(count)
+	indexer.stats.LastError = err.Error()
+	indexer.stats.LastErrorAt = time.Now().Local()
+}
+
+// _bulk响应
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		Status int             `json:"status"`
+		Error  json.RawMessage `json:"error"`
+	} `json:"items"`
+}
+
+// 是否可重试的状态码
+func isBulkRetryable(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// 发送一次_bulk请求，返回需重试的文档
+func (indexer *bulkIndexer) send(docs []*bulkDoc) ([]*bulkDoc, error) {
+	var buf bytes.Buffer
+	for _, doc := range docs {
+		action, _ := json.Marshal(map[string]interface{}{
+			"index": map[string]string{"_index": doc.index},
+		})
+		buf.Write(action)
+		buf.WriteByte('\n')
+		buf.Write(bytes.TrimRight(doc.body, "\n"))
+		buf.WriteByte('\n')
+	}
+	client := indexer.elastic.getClient()
+	if client == nil {
+		return docs, ErrElasticNotConnected
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ElasticBulkTimeout)
+	defer cancel()
+	res, err := client.Bulk(
+		&buf,
+		client.Bulk.WithContext(ctx),
+		client.Bulk.WithRefresh(indexer.elastic.getRefresh()),
+	)
+	indexer.mutex.Lock()
+	indexer.stats.Batches++
+	indexer.stats.LastFlush = time.Now().Local()
+	indexer.mutex.Unlock()
+	if err != nil {
+		indexer.elastic.setHealth(ElasticStateDown, err)
+		return docs, err
+	}
+	indexer.elastic.setHealth(ElasticStateUp, nil)
+	defer res.Body.Close()
+	body, _ := io.ReadAll(res.Body)
+	if isBulkRetryable(res.StatusCode) {
+		return docs, fmt.Errorf("bulk status %d: %s", res.StatusCode, string(body))
+	}
+	if res.IsError() {
+		indexer.fail(len(docs), fmt.Errorf("bulk status %d: %s", res.StatusCode, string(body)))
+		return nil, nil
+	}
+	var result bulkResponse
+	err = json.Unmarshal(body, &result)
+	if err != nil || len(result.Items) != len(docs) {
+		indexer.fail(len(docs), fmt.Errorf("invalid bulk response: %s", string(body)))
+		return nil, nil
+	}
+	retry := make([]*bulkDoc, 0)
+	var indexed, failed int
+	var lastErr string
+	for i, item := range result.Items {
+		for _, status := range item {
+			switch {
+			case status.Status >= 200 && status.Status < 300:
+				indexed++
+			case isBulkRetryable(status.Status):
+				retry = append(retry, docs[i])
+			default:
+				failed++
+				lastErr = string(status.Error)
+			}
+		}
+	}
+	indexer.mutex.Lock()
+	indexer.stats.Indexed += int64(indexed)
+	indexer.mutex.Unlock()
+	if failed > 0 {
+		indexer.fail(failed, fmt.Errorf("%d documents rejected: %s", failed, lastErr))
+	}
+	if len(retry) > 0 {
+		return retry, fmt.Errorf("%d documents rejected with retryable status", len(retry))
+	}
+	return nil, nil
+}
+
+// 获取统计
+func (indexer *bulkIndexer) getStats() ElasticStats {
+	indexer.mutex.Lock()
+	defer indexer.mutex.Unlock()
+	stats := indexer.stats
+	stats.Queued = len(indexer.queue)
+	if indexer.spool != nil {
+		stats.Spooled = indexer.spool.depth()
+		stats.SpoolBytes = indexer.spool.usage()
+		stats.SpoolOldest = indexer.spool.oldest()
+		if !stats.SpoolOldest.IsZero() {
+			stats.SpoolAge = int64(time.Since(stats.SpoolOldest).Seconds())
+		}
+	}
+	return stats
+}
@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	es7 "github.com/elastic/go-elasticsearch/v7"
+)
+
+func TestElasticWriteDropsWhenQueueFull(t *testing.T) {
+	elastic := &Elastic{}
+	elastic.bulk = &bulkIndexer{elastic: elastic, queue: make(chan *bulkDoc, 1)}
+	watcher := &WatcherConfig{App: "order"}
+	datas := []ExpiredData{{Datasource: "A"}, {Datasource: "B"}, {Datasource: "C"}}
+	start := time.Now()
+	err := elastic.Write(watcher, datas)
+	if !errors.Is(err, ErrElasticQueueFull) || !strings.Contains(err.Error(), "2 documents dropped") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("write blocked %s", elapsed)
+	}
+	if stats := elastic.bulk.getStats(); stats.Dropped != 2 || len(elastic.bulk.queue) != 1 {
+		t.Errorf("unexpected stats %v, queued %d", stats, len(elastic.bulk.queue))
+	}
+}
+
+// 模拟_bulk接口，按请求次序返回各文档状态
+func newBulkServer(t *testing.T, statuses [][]int) (*httptest.Server, *[][]string) {
+	t.Helper()
+	requests := make([][]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Elastic-Product", "Elasticsearch")
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path != "/_bulk" {
+			w.Write([]byte(`{"version":{"number":"7.17.10"}}`))
+			return
+		}
+		docs := make([]string, 0)
+		scanner := bufio.NewScanner(r.Body)
+		for i := 0; scanner.Scan(); i++ {
+			if i%2 == 1 {
+				docs = append(docs, scanner.Text())
+			}
+		}
+		n := len(requests)
+		requests = append(requests, docs)
+		items := make([]map[string]interface{}, len(docs))
+		for i := range docs {
+			status := 201
+			if n < len(statuses) {
+				status = statuses[n][i]
+			}
+			items[i] = map[string]interface{}{"index": map[string]interface{}{"status": status}}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": true, "items": items})
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestReplayRetriesRejectedInPlace(t *testing.T) {
+	server, requests := newBulkServer(t, [][]int{{201, 429, 400}})
+	client, err := es7.NewClient(es7.Config{Addresses: []string{server.URL}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	elastic := &Elastic{Client: client, FlushInterval: 1}
+	spool, err := openSpool(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elastic.bulk = &bulkIndexer{elastic: elastic, spool: spool}
+	docs := make([]*bulkDoc, 0)
+	for _, name := range []string{"a", "b", "c", "d"} {
+		docs = append(docs, &bulkDoc{"order", []byte(`{"Name":"` + name + `"}`), time.Now()})
+	}
+	_, err = spool.append(docs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	head, consumed, lines, err := spool.peek(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elastic.bulk.replayBatch(head)
+	err = spool.commit(consumed, lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 被拒绝的b原位重试，c永久拒绝不重试，均不放回落盘末尾
+	if len(*requests) != 2 || strings.Join((*requests)[1], ",") != `{"Name":"b"}` {
+		t.Errorf("unexpected requests %v", *requests)
+	}
+	if spool.depth() != 1 {
+		t.Errorf("unexpected spool depth %d", spool.depth())
+	}
+	rest, _, _, err := spool.peek(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 1 || string(rest[0].body) != `{"Name":"d"}` {
+		t.Errorf("unexpected spool docs %v", rest)
+	}
+	if stats := elastic.bulk.getStats(); stats.Indexed != 2 || stats.Failed != 1 || stats.Retried != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,568 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+var (
+	ErrChannelNotFound   = errors.New("channel not found")
+	ErrChannelNotSupport = errors.New("channel is not supported")
+)
+
+var (
+	ChannelTypeWebhook  = "webhook"
+	ChannelTypeDingTalk = "dingtalk"
+	ChannelTypeWeCom    = "wecom"
+	ChannelTypeFeishu   = "feishu"
+	ChannelTypeEmail    = "email"
+)
+
+// 通知状态，除告警状态firing/resolved外，测试通知为test
+var NotificationStatusTest = "test"
+
+// 通知默认超时时间
+const ChannelDefaultTimeout = 10 * time.Second
+
+// 通知默认重试次数
+const ChannelDefaultRetries = 3
+
+// 通知渠道
+type Channel struct {
+	Name           string            `yaml:"Name"`                     // 名称
+	Type           string            `yaml:"Type"`                     // 类型（webhook/dingtalk/wecom/feishu/email）
+	Url            string            `yaml:"Url,omitempty"`            // 地址，机器人为完整webhook地址
+	Headers        map[string]string `yaml:"Headers,omitempty"`        // 请求头
+	Secret         string            `yaml:"Secret,omitempty"`         // 签名密钥，webhook以HMAC-SHA256签名时间戳及请求体，写入X-Signature-256请求头，钉钉、飞书为机器人加签密钥
+	Title          string            `yaml:"Title,omitempty"`          // 机器人消息标题及邮件主题模板，默认使用DefaultBotTitle
+	Template       string            `yaml:"Template,omitempty"`       // 机器人消息markdown及邮件正文模板，默认使用DefaultBotTemplate
+	Server         string            `yaml:"Server,omitempty"`         // SMTP服务器（email）
+	Port           int               `yaml:"Port,omitempty"`           // SMTP端口（email），默认25，StartTLS时默认587
+	StartTLS       bool              `yaml:"StartTLS,omitempty"`       // 是否使用STARTTLS（email）
+	SkipVerify     bool              `yaml:"SkipVerify,omitempty"`     // 是否跳过证书校验（email）
+	Username       string            `yaml:"Username,omitempty"`       // SMTP用户名（email）
+	Password       string            `yaml:"Password,omitempty"`       // SMTP密码（email）
+	From           string            `yaml:"From,omitempty"`           // 发件人（email）
+	To             []string          `yaml:"To,omitempty"`             // 收件人（email）
+	Digest         string            `yaml:"Digest,omitempty"`         // 汇总报告Cron表达式（email），如0 0 8为每天8点，为空时不发送
+	DigestTemplate string            `yaml:"DigestTemplate,omitempty"` // 汇总报告正文模板，默认使用DefaultDigestTemplate
+	Tags           []string          `yaml:"Tags,omitempty"`           // 订阅标签，监控标签匹配任一时发送
+	Timeout        int               `yaml:"Timeout,omitempty"`        // 超时时间(s)，默认10s
+	Retries        *int              `yaml:"Retries,omitempty"`        // 失败重试次数，默认3次
+	EntryID        cron.EntryID      `yaml:"-" json:"-"`               // 汇总报告Cron运行时ID
+}
+
+// 隐藏签名密钥
+func (channel *Channel) MarshalJSON() ([]byte, error) {
+	type alias Channel
+	return json.Marshal(&struct {
+		*alias
+		Secret   string `json:"Secret,omitempty"`
+		Password string `json:"Password,omitempty"`
+	}{
+		alias: (*alias)(channel),
+	})
+}
+
+// 校验通知渠道配置
+func (channel *Channel) Validate() error {
+	if channel.Name == "" {
+		return fmt.Errorf("%w: channel has no name", ErrChannelNotSupport)
+	}
+	if channel.Retries != nil && *channel.Retries < 0 {
+		return fmt.Errorf("%w: retries %d", ErrChannelNotSupport, *channel.Retries)
+	}
+	switch channel.Type {
+	case ChannelTypeWebhook:
+	case ChannelTypeDingTalk, ChannelTypeWeCom, ChannelTypeFeishu:
+		_, _, err := channel.getTemplates()
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrChannelNotSupport, err.Error())
+		}
+	case ChannelTypeEmail:
+		return channel.validateEmail()
+	default:
+		return fmt.Errorf("%w: type %s", ErrChannelNotSupport, channel.Type)
+	}
+	if channel.Url == "" {
+		return fmt.Errorf("%w: channel %s has no url", ErrChannelNotSupport, channel.Name)
+	}
+	return nil
+}
+
+// 是否订阅监控标签
+func (channel *Channel) Subscribes(watcher *WatcherConfig) bool {
+	for _, tag := range channel.Tags {
+		if slices.Contains(watcher.Tags, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+func (channel *Channel) getTimeout() time.Duration {
+	if channel.Timeout <= 0 {
+		return ChannelDefaultTimeout
+	}
+	return time.Duration(channel.Timeout) * time.Second
+}
+
+func (channel *Channel) getRetries() int {
+	if channel.Retries == nil {
+		return ChannelDefaultRetries
+	}
+	return max(*channel.Retries, 0)
+}
+
+// 通知内容
+type Notification struct {
+	Status       string         // 状态（firing/resolved/test）
+	Rule         string         // 规则名称
+	Expr         string         // 条件表达式
+	Severity     string         // 级别
+	Value        float64        // 当前值
+	App          string         // 应用名称
+	Desc         string         // 描述
+	Module       string         // 模块
+	System       string         // 系统
+	Provider     string         // 提供方
+	Requester    string         // 请求方
+	Tags         []string       // 标签
+	Datasource   string         // 数据源编号
+	Expire1Day   int            // 过期1天数量
+	Expire1Week  int            // 过期1周数量
+	Expire1Month int            // 过期1月数量
+	Buckets      map[string]int // 分段数量
+	Extend       interface{}    // 扩展字段
+	ActiveAt     time.Time      // 条件开始满足时间
+	FiredAt      time.Time      // 触发时间
+	ResolvedAt   time.Time      // 恢复时间
+	TimeStamp    time.Time      // 通知时间
+	Watcher      *WatcherConfig `json:"-"` // 监控配置，供消息模板引用
+	Data         *ExpiredData   `json:"-"` // 触发数据，供消息模板引用
+}
+
+// 由告警事件生成通知内容
+func NewNotification(event AlertEvent) Notification {
+	notification := Notification{
+		Status:     event.Alert.State,
+		Rule:       event.Alert.Rule,
+		Expr:       event.Alert.Expr,
+		Severity:   event.Alert.Severity,
+		Value:      event.Alert.Value,
+		App:        event.Alert.App,
+		Datasource: event.Alert.Datasource,
+		ActiveAt:   event.Alert.ActiveAt,
+		FiredAt:    event.Alert.FiredAt,
+		ResolvedAt: event.Alert.ResolvedAt,
+		TimeStamp:  time.Now().Local(),
+		Watcher:    event.Watcher,
+		Data:       event.Data,
+	}
+	if watcher := event.Watcher; watcher != nil {
+		notification.Desc = watcher.Desc
+		notification.Module = watcher.Module
+		notification.System = watcher.System
+		notification.Provider = watcher.Provider
+		notification.Requester = watcher.Requester
+		notification.Tags = watcher.Tags
+	}
+	if data := event.Data; data != nil {
+		notification.Expire1Day = data.Expire1Day
+		notification.Expire1Week = data.Expire1Week
+		notification.Expire1Month = data.Expire1Month
+		notification.Buckets = data.Buckets
+		notification.Extend = data.Extend
+	}
+	return notification
+}
+
+// 渠道发送失败
+type channelHTTPError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *channelHTTPError) Error() string {
+	return fmt.Sprintf("http status %d: %s", e.StatusCode, e.Body)
+}
+
+// 机器人接口返回错误码
+type channelAPIError struct {
+	Code    int
+	Message string
+}
+
+func (e *channelAPIError) Error() string {
+	return fmt.Sprintf("errcode %d: %s", e.Code, e.Message)
+}
+
+// 渠道配置错误，如模板渲染失败
+type channelConfigError struct {
+	err error
+}
+
+func (e *channelConfigError) Error() string {
+	return e.err.Error()
+}
+
+func (e *channelConfigError) Unwrap() error {
+	return e.err
+}
+
+// 是否可重试，网络错误、429及5xx响应可重试
+func isChannelRetryable(err error) bool {
+	var httpErr *channelHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.StatusCode >= 500 || httpErr.StatusCode == http.StatusTooManyRequests
+	}
+	var apiErr *channelAPIError
+	var configErr *channelConfigError
+	return !errors.As(err, &apiErr) && !errors.As(err, &configErr)
+}
+
+// 发送通知
+func (channel *Channel) Send(ctx context.Context, notification *Notification) error {
+	err := channel.Validate()
+	if err != nil {
+		return err
+	}
+	switch channel.Type {
+	case ChannelTypeWebhook:
+		return channel.sendWebhook(ctx, notification)
+	case ChannelTypeDingTalk:
+		return channel.sendDingTalk(ctx, notification)
+	case ChannelTypeWeCom:
+		return channel.sendWeCom(ctx, notification)
+	case ChannelTypeFeishu:
+		return channel.sendFeishu(ctx, notification)
+	case ChannelTypeEmail:
+		return channel.sendEmail(ctx, notification)
+	}
+	return fmt.Errorf("%w: type %s", ErrChannelNotSupport, channel.Type)
+}
+
+// 发送webhook通知
+func (channel *Channel) sendWebhook(ctx context.Context, notification *Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return err
+	}
+	return channel.post(ctx, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, channel.Url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json;charset=UTF-8")
+		for key, val := range channel.Headers {
+			req.Header.Set(key, val)
+		}
+		if channel.Secret != "" {
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			req.Header.Set("X-Timestamp", timestamp)
+			req.Header.Set("X-Signature-256", "sha256="+SignWebhook(channel.Secret, timestamp, body))
+		}
+		return req, nil
+	}, nil)
+}
+
+// webhook签名，HMAC-SHA256(secret, timestamp + "." + body)的十六进制
+func SignWebhook(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// 按配置次数退避重试，fn返回不可重试错误时直接返回
+func (channel *Channel) retry(ctx context.Context, fn func() error) error {
+	var err error
+	for attempt := 0; attempt <= channel.getRetries(); attempt++ {
+		if attempt > 0 {
+			// 退避等待，1s、2s、4s...
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(500<<attempt) * time.Millisecond):
+			}
+		}
+		err = fn()
+		if err == nil || !isChannelRetryable(err) {
+			break
+		}
+	}
+	return err
+}
+
+// 发送请求，网络错误、429及5xx响应按配置次数退避重试，check校验2xx响应内容
+func (channel *Channel) post(ctx context.Context, newRequest func(ctx context.Context) (*http.Request, error), check func(body []byte) error) error {
+	return channel.retry(ctx, func() error {
+		req, err := newRequest(ctx)
+		if err != nil {
+			return &channelConfigError{err}
+		}
+		return channel.do(req, check)
+	})
+}
+
+// 发起单次请求
+func (channel *Channel) do(req *http.Request, check func(body []byte) error) error {
+	ctx, cancel := context.WithTimeout(req.Context(), channel.getTimeout())
+	defer cancel()
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &channelHTTPError{resp.StatusCode, string(body)}
+	}
+	if check != nil {
+		return check(body)
+	}
+	return nil
+}
+
+// 通知渠道测试结果
+type ChannelTestResult struct {
+	Name    string // 名称
+	Type    string // 类型
+	Success bool   // 是否成功
+	Latency int64  // 耗时(ms)
+	Error   string // 错误信息
+}
+
+// 发送测试通知
+func (channel *Channel) Test() *ChannelTestResult {
+	notification := Notification{
+		Status:    NotificationStatusTest,
+		Rule:      "test",
+		Severity:  AlertSeverityInfo,
+		App:       "test",
+		Desc:      "通知渠道测试",
+		TimeStamp: time.Now().Local(),
+		Watcher:   &WatcherConfig{App: "test", Desc: "通知渠道测试"},
+		Data:      &ExpiredData{},
+	}
+	result := &ChannelTestResult{
+		Name: channel.Name,
+		Type: channel.Type,
+	}
+	start := time.Now()
+	err := channel.Send(context.Background(), &notification)
+	result.Latency = time.Since(start).Milliseconds()
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	result.Success = true
+	return result
+}
+
+// 通知发送，监听告警状态变化并发送到监控引用或按标签订阅的渠道
+type Notifier struct {
+	Channels   *[]*Channel           // 通知渠道列表
+	Watchers   *[]*WatcherConfig     // 监控列表，用于汇总报告
+	Silences   *[]*Silence           // 静默列表
+	Alerts     *AlertManager         // 告警管理，静默结束后确认告警仍在触发
+	Elastic    *Elastic              // Elasticsearch
+	Mutex      sync.Mutex            // 互斥锁
+	Suppressed map[string]AlertEvent // 静默期间触发未通知的告警，键为App/Rule/Datasource
+	EntryID    cron.EntryID          // 补发任务Cron运行时ID
+}
+
+func NewNotifier(channels *[]*Channel, watchers *[]*WatcherConfig, silences *[]*Silence, alerts *AlertManager, elastic *Elastic) *Notifier {
+	return &Notifier{
+		Channels:   channels,
+		Watchers:   watchers,
+		Silences:   silences,
+		Alerts:     alerts,
+		Elastic:    elastic,
+		Suppressed: map[string]AlertEvent{},
+	}
+}
+
+// 获取通知渠道
+func (notifier *Notifier) GetChannel(name string) (*Channel, error) {
+	for _, channel := range *notifier.Channels {
+		if channel.Name == name {
+			return channel, nil
+		}
+	}
+	return nil, ErrChannelNotFound
+}
+
+// 校验渠道名称
+func (notifier *Notifier) CheckChannels(names []string) error {
+	for _, name := range names {
+		_, err := notifier.GetChannel(name)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, name)
+		}
+	}
+	return nil
+}
+
+// 获取监控的通知渠道
+func (notifier *Notifier) GetWatcherChannels(watcher *WatcherConfig) []*Channel {
+	channels := make([]*Channel, 0)
+	for _, channel := range *notifier.Channels {
+		if slices.Contains(watcher.Channels, channel.Name) || channel.Subscribes(watcher) {
+			channels = append(channels, channel)
+		}
+	}
+	return channels
+}
+
+// 告警状态变化时发送通知，存在生效的静默时不发送，触发通知在静默结束后补发
+func (notifier *Notifier) Notify(event AlertEvent) {
+	key := alertKey(event.Alert.App, event.Alert.Rule, event.Alert.Datasource)
+	notifier.Mutex.Lock()
+	_, suppressed := notifier.Suppressed[key]
+	if event.Alert.State == AlertStateResolved {
+		delete(notifier.Suppressed, key)
+	}
+	if silence := FindSilence(*notifier.Silences, event.Watcher, event.Alert.Datasource, time.Now()); silence != nil {
+		if event.Alert.State == AlertStateFiring {
+			if notifier.Suppressed == nil {
+				notifier.Suppressed = map[string]AlertEvent{}
+			}
+			notifier.Suppressed[key] = event
+		}
+		notifier.Mutex.Unlock()
+		log.Printf("Notification of %s %s %s silenced by %s", event.Alert.App, event.Alert.Rule, event.Alert.State, silence.ID)
+		return
+	}
+	notifier.Mutex.Unlock()
+	if suppressed && event.Alert.State == AlertStateResolved {
+		// 触发通知未发送，恢复通知同样不发送
+		return
+	}
+	notifier.notify(event)
+}
+
+// 向监控的通知渠道发送告警事件
+func (notifier *Notifier) notify(event AlertEvent) {
+	notification := NewNotification(event)
+	for _, channel := range notifier.GetWatcherChannels(event.Watcher) {
+		go notifier.send(channel, &notification)
+	}
+}
+
+// 补发静默期间触发、静默结束后仍在触发的告警通知，已恢复或已移除的告警不再补发
+func (notifier *Notifier) Resend(now time.Time) {
+	events := make([]AlertEvent, 0)
+	notifier.Mutex.Lock()
+	for key, event := range notifier.Suppressed {
+		watcher := notifier.getWatcher(event.Alert.App)
+		if watcher != nil && FindSilence(*notifier.Silences, watcher, event.Alert.Datasource, now) != nil {
+			continue
+		}
+		delete(notifier.Suppressed, key)
+		if watcher == nil || notifier.Alerts == nil {
+			continue
+		}
+		alert, ok := notifier.Alerts.GetAlert(event.Alert.App, event.Alert.Rule, event.Alert.Datasource)
+		if !ok || alert.State != AlertStateFiring || !alert.FiredAt.Equal(event.Alert.FiredAt) {
+			continue
+		}
+		events = append(events, AlertEvent{Alert: alert, Watcher: watcher, Data: alert.Data})
+	}
+	notifier.Mutex.Unlock()
+	for _, event := range events {
+		log.Printf("Resend notification of %s %s after silence", event.Alert.App, event.Alert.Rule)
+		notifier.notify(event)
+	}
+}
+
+// 获取监控
+func (notifier *Notifier) getWatcher(app string) *WatcherConfig {
+	if notifier.Watchers == nil {
+		return nil
+	}
+	for _, watcher := range *notifier.Watchers {
+		if watcher.App == app {
+			return watcher
+		}
+	}
+	return nil
+}
+
+func (notifier *Notifier) send(channel *Channel, notification *Notification) {
+	err := channel.Send(context.Background(), notification)
+	if err == nil {
+		return
+	}
+	log.Printf("Send notification to %s failed: %v", channel.Name, err)
+	if notifier.Elastic != nil {
+		notifier.Elastic.NewError("发送通知失败", err.Error(), map[string]interface{}{
+			"Channel": channel.Name,
+			"Type":    channel.Type,
+			"App":     notification.App,
+			"Rule":    notification.Rule,
+			"Status":  notification.Status,
+		})
+	}
+}
+
+// 发送汇总报告
+func (notifier *Notifier) SendDigest(name string) error {
+	channel, err := notifier.GetChannel(name)
+	if err != nil {
+		return err
+	}
+	return channel.SendDigest(context.Background(), NewDigest(*notifier.Watchers))
+}
+
+// 在调度器中添加汇总报告及静默结束补发任务
+func (notifier *Notifier) Start(cron *cron.Cron) {
+	if notifier.EntryID == 0 {
+		id, err := cron.AddFunc("@every 1m", func() {
+			notifier.Resend(time.Now())
+		})
+		if err != nil {
+			log.Printf("Add notification resend failed: %v", err)
+		} else {
+			notifier.EntryID = id
+		}
+	}
+	for _, channel := range *notifier.Channels {
+		if channel.Type != ChannelTypeEmail || channel.Digest == "" || channel.EntryID != 0 {
+			continue
+		}
+		name := channel.Name
+		id, err := cron.AddFunc(channel.Digest, func() {
+			err := notifier.SendDigest(name)
+			if err == nil {
+				return
+			}
+			log.Printf("Send digest to %s failed: %v", name, err)
+			if notifier.Elastic != nil {
+				notifier.Elastic.NewError("发送汇总报告失败", err.Error(), map[string]interface{}{
+					"Channel": name,
+				})
+			}
+		})
+		if err != nil {
+			log.Printf("Add digest of %s failed: %v", name, err)
+			continue
+		}
+		channel.EntryID = id
+	}
+}
@@ -0,0 +1,86 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotifyResendAfterSilence(t *testing.T) {
+	received := make(chan Notification, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var notification Notification
+		json.NewDecoder(r.Body).Decode(&notification)
+		received <- notification
+	}))
+	defer server.Close()
+	expectNone := func() {
+		t.Helper()
+		select {
+		case notification := <-received:
+			t.Fatalf("unexpected notification %s %s", notification.App, notification.Status)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+
+	now := time.Now()
+	channels := []*Channel{{Name: "hook", Type: ChannelTypeWebhook, Url: server.URL}}
+	watchers := []*WatcherConfig{
+		{App: "order", Channels: []string{"hook"}, Alerts: []AlertRule{{Name: "backlog", Expr: "Expire1Day > 5"}}},
+		{App: "stock", Channels: []string{"hook"}, Alerts: []AlertRule{{Name: "backlog", Expr: "Expire1Day > 5"}}},
+	}
+	silences := []*Silence{{ID: "s1", Datasource: "A", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}}
+	alerts := NewAlertManager()
+	notifier := NewNotifier(&channels, &watchers, &silences, alerts, nil)
+	alerts.OnChange(notifier.Notify)
+
+	// 静默期间触发，order保持触发，stock在静默期间恢复
+	alerts.Evaluate(watchers[0], []ExpiredData{{Datasource: "A", Expire1Day: 8}})
+	alerts.Evaluate(watchers[1], []ExpiredData{{Datasource: "A", Expire1Day: 8}})
+	alerts.Evaluate(watchers[1], []ExpiredData{{Datasource: "A", Expire1Day: 1}})
+	expectNone()
+	notifier.Resend(now)
+	expectNone()
+
+	// 静默结束后仅补发仍在触发的告警，且只补发一次
+	notifier.Resend(now.Add(2 * time.Hour))
+	select {
+	case notification := <-received:
+		if notification.App != "order" || notification.Status != AlertStateFiring || notification.Value != 8 {
+			t.Errorf("unexpected notification %s %s %v", notification.App, notification.Status, notification.Value)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("notification is not resent")
+	}
+	expectNone()
+	notifier.Resend(now.Add(2 * time.Hour))
+	expectNone()
+}
+
+func TestChannelNegativeRetries(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+	retries := -1
+	channel := &Channel{Name: "hook", Type: ChannelTypeWebhook, Url: server.URL, Retries: &retries}
+	err := channel.Send(context.Background(), &Notification{App: "order", Status: AlertStateFiring})
+	if !errors.Is(err, ErrChannelNotSupport) || requests != 0 {
+		t.Errorf("negative retries is accepted, error %v, requests %d", err, requests)
+	}
+
+	// 未经校验的负数按0次重试处理，仍执行一次
+	calls := 0
+	err = channel.retry(context.Background(), func() error {
+		calls++
+		return nil
+	})
+	if err != nil || calls != 1 {
+		t.Errorf("unexpected calls %d, error %v", calls, err)
+	}
+}
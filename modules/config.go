@@ -15,6 +15,10 @@ type Config struct {
 	Elastic     *Elastic          `yaml:"Elastic"`     // Elasticsearch
 	Datasources *[]*Datasource    `yaml:"Datasources"` // 数据源列表
 	Watchers    *[]*WatcherConfig `yaml:"Watchers"`    // 监控列表
+	Channels    *[]*Channel       `yaml:"Channels"`    // 通知渠道列表
+	Silences    *[]*Silence       `yaml:"Silences"`    // 静默列表
+	History     *History          `yaml:"History"`     // 运行历史
+	Sinks       *[]*SinkConfig    `yaml:"Sinks"`       // 结果输出列表，另有内置输出elastic
 }
 
 // 保存配置文件
@@ -39,5 +43,20 @@ func NewConfig() *Config {
 		log.Fatalf("Parse config file failed: %v", err)
 		panic("Config file cannot parse.")
 	}
+	if conf.Elastic == nil {
+		conf.Elastic = &Elastic{}
+	}
+	if conf.Channels == nil {
+		conf.Channels = &[]*Channel{}
+	}
+	if conf.Silences == nil {
+		conf.Silences = &[]*Silence{}
+	}
+	if conf.Sinks == nil {
+		conf.Sinks = &[]*SinkConfig{}
+	}
+	if conf.History == nil {
+		conf.History = &History{}
+	}
 	return &conf
 }
@@ -0,0 +1,209 @@
+package modules
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/sijms/go-ora/v2/configurations"
+)
+
+// 密码包含连接串中的特殊字符
+const testPassword = "p@ss;w=rd/?#"
+
+func TestSQLServerDSN(t *testing.T) {
+	datasource := &Datasource{
+		Type:     DatasourceTypeSQLServer,
+		Server:   "10.88.2.146",
+		Port:     1433,
+		Service:  "MES",
+		Username: "sa",
+		Password: testPassword,
+		Database: "AUXMESDB",
+		Options: map[string]string{
+			"encrypt":            "disable",
+			"connection timeout": "5",
+		},
+	}
+	cfg, err := msdsn.Parse(datasource.GetDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "10.88.2.146" || cfg.Port != 1433 || cfg.Instance != "MES" {
+		t.Errorf("unexpected server %s:%d/%s", cfg.Host, cfg.Port, cfg.Instance)
+	}
+	if cfg.User != "sa" || cfg.Password != testPassword {
+		t.Errorf("unexpected credential %s:%s", cfg.User, cfg.Password)
+	}
+	if cfg.Database != "AUXMESDB" {
+		t.Errorf("unexpected database %s", cfg.Database)
+	}
+	if cfg.Encryption != msdsn.EncryptionDisabled {
+		t.Errorf("unexpected encryption %v", cfg.Encryption)
+	}
+	if cfg.ConnTimeout != 5*time.Second {
+		t.Errorf("unexpected connection timeout %v", cfg.ConnTimeout)
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	datasource := &Datasource{
+		Type:     DatasourceTypeMySQL,
+		Server:   "10.88.2.147",
+		Username: "root",
+		Password: testPassword,
+		Database: "wms",
+		Options: map[string]string{
+			"timeout":   "5s",
+			"parseTime": "false",
+		},
+	}
+	cfg, err := mysql.ParseDSN(datasource.GetDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Net != "tcp" || cfg.Addr != "10.88.2.147:3306" {
+		t.Errorf("unexpected address %s(%s)", cfg.Net, cfg.Addr)
+	}
+	if cfg.User != "root" || cfg.Passwd != testPassword {
+		t.Errorf("unexpected credential %s:%s", cfg.User, cfg.Passwd)
+	}
+	if cfg.DBName != "wms" {
+		t.Errorf("unexpected database %s", cfg.DBName)
+	}
+	if cfg.Params["charset"] != "utf8mb4" {
+		t.Errorf("unexpected charset %s", cfg.Params["charset"])
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("unexpected timeout %v", cfg.Timeout)
+	}
+	if cfg.ParseTime {
+		t.Error("parseTime option not applied")
+	}
+}
+
+func TestSQLiteDSN(t *testing.T) {
+	datasource := &Datasource{
+		Type:     DatasourceTypeSQLite,
+		Database: filepath.Join(t.TempDir(), "wms.db"),
+		Options: map[string]string{
+			"_pragma": "busy_timeout(1234)",
+		},
+	}
+	db, err := sql.Open("sqlite", datasource.GetDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var timeout int
+	err = db.QueryRow("PRAGMA busy_timeout").Scan(&timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 1234 {
+		t.Errorf("unexpected busy timeout %d", timeout)
+	}
+}
+
+func TestOracleDSN(t *testing.T) {
+	datasource := &Datasource{
+		Type:     DatasourceTypeOracle,
+		Server:   "10.88.2.148",
+		Database: "ORCL",
+		Username: "mes",
+		Password: testPassword,
+		Options: map[string]string{
+			"TIMEOUT": "5",
+		},
+	}
+	cfg, err := configurations.ParseConfig(datasource.GetDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Servers) != 1 || cfg.Servers[0].Addr != "10.88.2.148" || cfg.Servers[0].Port != 1521 {
+		t.Errorf("unexpected servers %v", cfg.Servers)
+	}
+	if cfg.UserID != "mes" || cfg.Password != testPassword {
+		t.Errorf("unexpected credential %s:%s", cfg.UserID, cfg.Password)
+	}
+	if cfg.ServiceName != "ORCL" {
+		t.Errorf("unexpected service %s", cfg.ServiceName)
+	}
+	if cfg.Timeout != 5*time.Second {
+		t.Errorf("unexpected timeout %v", cfg.Timeout)
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	datasource := &Datasource{
+		Type:     DatasourceTypePostgres,
+		Server:   "10.88.2.149",
+		Port:     5433,
+		Username: "wms",
+		Password: testPassword,
+		Database: "wms",
+		Options: map[string]string{
+			"sslmode":         "disable",
+			"connect_timeout": "5",
+		},
+	}
+	cfg, err := pgconn.ParseConfig(datasource.GetDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Host != "10.88.2.149" || cfg.Port != 5433 {
+		t.Errorf("unexpected server %s:%d", cfg.Host, cfg.Port)
+	}
+	if cfg.User != "wms" || cfg.Password != testPassword {
+		t.Errorf("unexpected credential %s:%s", cfg.User, cfg.Password)
+	}
+	if cfg.Database != "wms" {
+		t.Errorf("unexpected database %s", cfg.Database)
+	}
+	if cfg.TLSConfig != nil {
+		t.Error("sslmode option not applied")
+	}
+	if cfg.ConnectTimeout != 5*time.Second {
+		t.Errorf("unexpected connect timeout %v", cfg.ConnectTimeout)
+	}
+}
+
+func TestAPIRetries(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+	datasource := &Datasource{
+		Code:    "API",
+		Type:    DatasourceTypeAPI,
+		Url:     server.URL,
+		Retries: -1,
+	}
+	if err := datasource.Validate(); !errors.Is(err, ErrDatasourceNotSupport) {
+		t.Errorf("expected negative retries rejected, got %v", err)
+	}
+	// 配置文件中的负数按不重试处理
+	resp, body, err := datasource.Request(context.Background(), &APIRequestData{})
+	if err != nil || resp == nil || string(body) != "[]" {
+		t.Errorf("unexpected response %v %s %v", resp, body, err)
+	}
+}
+
+func TestWatcherRequestTemplate(t *testing.T) {
+	watcher := &WatcherConfig{App: "api", Request: `{"since":"{{.Now.Format "2006-01-02"}}"}`}
+	if err := watcher.ValidateRequest(); err != nil {
+		t.Error(err)
+	}
+	watcher.Request = `{"since":"{{.Now.Format}"}`
+	if err := watcher.ValidateRequest(); !errors.Is(err, ErrWatcherRequestInvalid) {
+		t.Errorf("expected invalid request template, got %v", err)
+	}
+}
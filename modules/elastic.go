@@ -1,65 +1,193 @@
 package modules
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"strings"
+	"sync"
 	"time"
 
 	es7 "github.com/elastic/go-elasticsearch/v7"
 	"github.com/elastic/go-elasticsearch/v7/estransport"
 )
 
+var (
+	ElasticStateDisabled   = "disabled"
+	ElasticStateConnecting = "connecting"
+	ElasticStateUp         = "up"
+	ElasticStateDown       = "down"
+)
+
+// 连接正常时的健康检查间隔
+const ElasticHealthInterval = 30 * time.Second
+
+// 连接异常时的重连间隔
+const ElasticReconnectInterval = 10 * time.Second
+
+// 健康检查超时时间
+const ElasticPingTimeout = 5 * time.Second
+
+// Elasticsearch，未配置地址时不写入，连接异常时不影响调度，后台定期重连
 type Elastic struct {
-	Addresses []string    `yaml:"Addresses"`
-	Username  string      `yaml:"Username"`
-	Password  string      `yaml:"Password"`
-	Client    *es7.Client `yaml:"-" json:"-"`
+	Addresses     []string    `yaml:"Addresses"`
+	Username      string      `yaml:"Username"`
+	Password      string      `yaml:"Password"`
+	BatchSize     int         `yaml:"BatchSize,omitempty"`     // 批量写入条数，默认500
+	FlushInterval int         `yaml:"FlushInterval,omitempty"` // 定时写入间隔(s)，默认5s
+	QueueSize     int         `yaml:"QueueSize,omitempty"`     // 写入队列容量，默认10000，队列满时丢弃
+	Refresh       string      `yaml:"Refresh,omitempty"`       // 写入后刷新策略，true/false/wait_for，默认false
+	Retries       *int        `yaml:"Retries,omitempty"`       // 429及5xx响应重试次数，默认3次
+	SpoolPath     string      `yaml:"SpoolPath,omitempty"`     // 写入失败时落盘目录，默认./spool
+	SpoolSize     int         `yaml:"SpoolSize,omitempty"`     // 落盘容量上限(MB)，默认512MB，超出时丢弃
+	Client        *es7.Client `yaml:"-" json:"-"`
+	bulk          *bulkIndexer
+	mutex         sync.Mutex
+	health        ElasticHealth
 }
 
+// Elasticsearch健康状态
+type ElasticHealth struct {
+	State     string    // 状态，disabled/connecting/up/down
+	Addresses []string  // 地址
+	Error     string    // 最近一次错误
+	Since     time.Time // 进入当前状态的时间
+	LastCheck time.Time // 最近一次检查时间
+}
+
+// 启动批量写入及后台连接检查，未配置地址时不启用
 func (conf *Elastic) Init() {
-	client, err := es7.NewClient(es7.Config{
-		Addresses: conf.Addresses,
-		Username:  conf.Username,
-		Password:  conf.Password,
-	})
-	if err != nil {
-		log.Fatalf("Connect to es failed: %v", err)
-		panic(err)
+	if len(conf.Addresses) == 0 {
+		conf.setHealth(ElasticStateDisabled, nil)
+		return
+	}
+	if conf.bulk != nil {
+		return
 	}
-	conf.Client = client
-	log.Println(client.Transport.(*estransport.Client).URLs())
+	conf.setHealth(ElasticStateConnecting, nil)
+	conf.bulk = newBulkIndexer(conf)
+	go conf.bulk.run()
+	if conf.bulk.spool != nil {
+		go conf.bulk.replay()
+	}
+	go conf.watch()
 }
 
-func (conf *Elastic) Log(index string, data interface{}) error {
-	if conf.Client == nil {
-		conf.Init()
+// 定期检查连接，异常时按重连间隔重试
+func (conf *Elastic) watch() {
+	for {
+		err := conf.ping()
+		if err != nil {
+			conf.setHealth(ElasticStateDown, err)
+			time.Sleep(ElasticReconnectInterval)
+			continue
+		}
+		conf.setHealth(ElasticStateUp, nil)
+		time.Sleep(ElasticHealthInterval)
+	}
+}
+
+// 检查连接，客户端未创建时先创建
+func (conf *Elastic) ping() error {
+	client := conf.getClient()
+	if client == nil {
+		var err error
+		client, err = es7.NewClient(es7.Config{
+			Addresses: conf.Addresses,
+			Username:  conf.Username,
+			Password:  conf.Password,
+		})
+		if err != nil {
+			return err
+		}
+		log.Println(client.Transport.(*estransport.Client).URLs())
+		conf.mutex.Lock()
+		conf.Client = client
+		conf.mutex.Unlock()
 	}
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(data)
+	ctx, cancel := context.WithTimeout(context.Background(), ElasticPingTimeout)
+	defer cancel()
+	res, err := client.Ping(client.Ping.WithContext(ctx))
 	if err != nil {
 		return err
 	}
-	res, err := conf.Client.Index(
-		strings.ToLower(index),
-		&buf,
-		conf.Client.Index.WithContext(context.Background()),
-		conf.Client.Index.WithRefresh("true"),
-	)
-	defer res.Body.Close()
+	res.Body.Close()
+	if res.IsError() {
+		return fmt.Errorf("ping status %d", res.StatusCode)
+	}
+	return nil
+}
+
+func (conf *Elastic) getClient() *es7.Client {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	return conf.Client
+}
+
+// 更新健康状态，状态变化时记录日志
+func (conf *Elastic) setHealth(state string, err error) {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	now := time.Now().Local()
+	if conf.health.State != state {
+		if err != nil {
+			log.Printf("Elasticsearch is %s: %v", state, err)
+		} else {
+			log.Printf("Elasticsearch is %s", state)
+		}
+		conf.health.State = state
+		conf.health.Since = now
+	}
+	conf.health.Error = ""
+	if err != nil {
+		conf.health.Error = err.Error()
+	}
+	conf.health.LastCheck = now
+	if state == ElasticStateUp {
+		metricElasticUp.Set(1)
+	} else {
+		metricElasticUp.Set(0)
+	}
+}
+
+// 获取健康状态
+func (conf *Elastic) GetHealth() ElasticHealth {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	health := conf.health
+	health.Addresses = conf.Addresses
+	if health.State == "" {
+		health.State = ElasticStateDisabled
+	}
+	return health
+}
+
+// 是否确认不可用
+func (conf *Elastic) isDown() bool {
+	conf.mutex.Lock()
+	defer conf.mutex.Unlock()
+	return conf.health.State == ElasticStateDown
+}
+
+// 写入文档，加入批量写入队列，队列满时丢弃，未启用时忽略
+func (conf *Elastic) Log(index string, data interface{}) error {
+	if conf == nil || conf.bulk == nil {
+		return nil
+	}
+	body, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
-	if res.StatusCode != http.StatusCreated {
-		_bytes, _ := io.ReadAll(res.Body)
-		fmt.Printf("Log index failed. Error:%s\n", string(_bytes))
+	return conf.bulk.add(strings.ToLower(index), body)
+}
+
+// 获取批量写入统计
+func (conf *Elastic) GetStats() ElasticStats {
+	if conf.bulk == nil {
+		return ElasticStats{}
 	}
-	return nil
+	return conf.bulk.getStats()
 }
 
 const LogIndex = "logs"
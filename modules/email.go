@@ -0,0 +1,258 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// 汇总报告默认正文模板，数据为Digest
+const DefaultDigestTemplate = `呆滞数据汇总 {{.TimeStamp.Format "2006-01-02 15:04:05"}}
+{{range .Groups}}
+[{{.Module}} / {{.System}}]
+{{range .Watchers}}- {{.App}} {{.Desc}}{{if not .Enabled}}（未启用）{{end}}
+{{range .Datas}}    {{.Datasource}}：{{range $name, $count := .Buckets}}{{$name}}={{$count}} {{end}}（{{.TimeStamp.Format "01-02 15:04:05"}}）
+{{else}}    暂无数据
+{{end}}{{end}}{{end}}`
+
+// 校验email渠道配置
+func (channel *Channel) validateEmail() error {
+	if channel.Server == "" {
+		return fmt.Errorf("%w: channel %s has no smtp server", ErrChannelNotSupport, channel.Name)
+	}
+	_, err := mail.ParseAddress(channel.From)
+	if err != nil {
+		return fmt.Errorf("%w: from %s", ErrChannelNotSupport, channel.From)
+	}
+	if len(channel.To) == 0 {
+		return fmt.Errorf("%w: channel %s has no recipient", ErrChannelNotSupport, channel.Name)
+	}
+	for _, to := range channel.To {
+		_, err := mail.ParseAddress(to)
+		if err != nil {
+			return fmt.Errorf("%w: to %s", ErrChannelNotSupport, to)
+		}
+	}
+	_, _, err = channel.getTemplates()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrChannelNotSupport, err.Error())
+	}
+	_, err = channel.getDigestTemplate()
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrChannelNotSupport, err.Error())
+	}
+	if channel.Digest != "" {
+		_, err = CronParser.Parse(channel.Digest)
+		if err != nil {
+			return fmt.Errorf("%w: digest %s", ErrChannelNotSupport, channel.Digest)
+		}
+	}
+	return nil
+}
+
+func (channel *Channel) getDigestTemplate() (*template.Template, error) {
+	text := channel.DigestTemplate
+	if text == "" {
+		text = DefaultDigestTemplate
+	}
+	return template.New(channel.Name + ".digest").Parse(text)
+}
+
+func (channel *Channel) getSMTPPort() int {
+	if channel.Port > 0 {
+		return channel.Port
+	}
+	if channel.StartTLS {
+		return 587
+	}
+	return 25
+}
+
+// 发送告警邮件
+func (channel *Channel) sendEmail(ctx context.Context, notification *Notification) error {
+	subject, body, err := channel.render(notification)
+	if err != nil {
+		return &channelConfigError{err}
+	}
+	return channel.SendMail(ctx, subject, body)
+}
+
+// 发送邮件，连接失败及4xx临时错误按配置次数退避重试
+func (channel *Channel) SendMail(ctx context.Context, subject string, body string) error {
+	err := channel.Validate()
+	if err != nil {
+		return err
+	}
+	return channel.retry(ctx, func() error {
+		err := channel.deliver(subject, body)
+		var protoErr *textproto.Error
+		if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+			return &channelAPIError{protoErr.Code, protoErr.Msg}
+		}
+		return err
+	})
+}
+
+// 投递单封邮件
+func (channel *Channel) deliver(subject string, body string) error {
+	from, _ := mail.ParseAddress(channel.From)
+	addr := net.JoinHostPort(channel.Server, strconv.Itoa(channel.getSMTPPort()))
+	conn, err := net.DialTimeout("tcp", addr, channel.getTimeout())
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(channel.getTimeout()))
+	client, err := smtp.NewClient(conn, channel.Server)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+	if channel.StartTLS {
+		err = client.StartTLS(&tls.Config{
+			ServerName:         channel.Server,
+			InsecureSkipVerify: channel.SkipVerify,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if channel.Username != "" {
+		err = client.Auth(smtp.PlainAuth("", channel.Username, channel.Password, channel.Server))
+		if err != nil {
+			return err
+		}
+	}
+	err = client.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	for _, to := range channel.To {
+		rcpt, _ := mail.ParseAddress(to)
+		err = client.Rcpt(rcpt.Address)
+		if err != nil {
+			return err
+		}
+	}
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(channel.buildMessage(subject, body))
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+	return client.Quit()
+}
+
+// 生成邮件内容，正文以base64编码
+func (channel *Channel) buildMessage(subject string, body string) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("From: " + channel.From + "\r\n")
+	buf.WriteString("To: " + strings.Join(channel.To, ", ") + "\r\n")
+	buf.WriteString("Subject: " + mime.BEncoding.Encode("UTF-8", subject) + "\r\n")
+	buf.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+	encoded := base64.StdEncoding.EncodeToString([]byte(body))
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded + "\r\n")
+	return buf.Bytes()
+}
+
+// 汇总报告
+type Digest struct {
+	TimeStamp time.Time     // 生成时间
+	Groups    []DigestGroup // 按模块、系统分组
+}
+
+// 汇总报告分组
+type DigestGroup struct {
+	Module   string          // 模块
+	System   string          // 系统
+	Watchers []DigestWatcher // 监控列表
+}
+
+// 汇总报告监控
+type DigestWatcher struct {
+	App     string        // 应用名称
+	Desc    string        // 描述
+	Enabled bool          // 是否启用
+	Datas   []ExpiredData // 最近一次运行结果
+}
+
+// 生成汇总报告，按模块、系统分组
+func NewDigest(watchers []*WatcherConfig) *Digest {
+	digest := &Digest{
+		TimeStamp: time.Now().Local(),
+		Groups:    make([]DigestGroup, 0),
+	}
+	index := map[string]int{}
+	for _, watcher := range watchers {
+		key := watcher.Module + "\x00" + watcher.System
+		i, ok := index[key]
+		if !ok {
+			i = len(digest.Groups)
+			index[key] = i
+			digest.Groups = append(digest.Groups, DigestGroup{
+				Module: watcher.Module,
+				System: watcher.System,
+			})
+		}
+		watcher.Mutex.Lock()
+		datas := watcher.Latest
+		watcher.Mutex.Unlock()
+		digest.Groups[i].Watchers = append(digest.Groups[i].Watchers, DigestWatcher{
+			App:     watcher.App,
+			Desc:    watcher.Desc,
+			Enabled: watcher.Enabled,
+			Datas:   datas,
+		})
+	}
+	sort.SliceStable(digest.Groups, func(i, j int) bool {
+		if digest.Groups[i].Module != digest.Groups[j].Module {
+			return digest.Groups[i].Module < digest.Groups[j].Module
+		}
+		return digest.Groups[i].System < digest.Groups[j].System
+	})
+	return digest
+}
+
+// 发送汇总报告
+func (channel *Channel) SendDigest(ctx context.Context, digest *Digest) error {
+	if channel.Type != ChannelTypeEmail {
+		return fmt.Errorf("%w: digest requires email channel", ErrChannelNotSupport)
+	}
+	tmpl, err := channel.getDigestTemplate()
+	if err != nil {
+		return err
+	}
+	var body bytes.Buffer
+	err = tmpl.Execute(&body, digest)
+	if err != nil {
+		return err
+	}
+	subject := "呆滞数据汇总 " + digest.TimeStamp.Format("2006-01-02")
+	return channel.SendMail(ctx, subject, body.String())
+}
@@ -0,0 +1,222 @@
+package modules
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 模拟SMTP服务收到的邮件
+type smtpMail struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string
+}
+
+// 模拟SMTP服务，rcptCode为RCPT命令的响应
+type smtpServer struct {
+	Listener net.Listener
+	RcptCode string
+	Mutex    sync.Mutex
+	Mails    []smtpMail
+}
+
+func newSMTPServer(t *testing.T, rcptCode string) *smtpServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &smtpServer{Listener: listener, RcptCode: rcptCode}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(t, conn)
+		}
+	}()
+	return server
+}
+
+// 获取监听端口
+func (server *smtpServer) port() int {
+	return server.Listener.Addr().(*net.TCPAddr).Port
+}
+
+func (server *smtpServer) getMails() []smtpMail {
+	server.Mutex.Lock()
+	defer server.Mutex.Unlock()
+	return append([]smtpMail{}, server.Mails...)
+}
+
+// 处理单个连接，不支持STARTTLS及AUTH
+func (server *smtpServer) serve(t *testing.T, conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(line string) {
+		conn.Write([]byte(line + "\r\n"))
+	}
+	reply("220 localhost ESMTP")
+	var envelope smtpMail
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(command, "MAIL FROM:"):
+			envelope = smtpMail{From: strings.Trim(line[len("MAIL FROM:"):], "<>")}
+			reply("250 OK")
+		case strings.HasPrefix(command, "RCPT TO:"):
+			if server.RcptCode != "250" {
+				reply(server.RcptCode + " mailbox unavailable")
+				continue
+			}
+			envelope.To = append(envelope.To, strings.Trim(line[len("RCPT TO:"):], "<>"))
+			reply("250 OK")
+		case command == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				line, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(line, "."))
+			}
+			msg, err := mail.ReadMessage(strings.NewReader(data.String()))
+			if err != nil {
+				t.Errorf("invalid message %s", data.String())
+				reply("554 invalid message")
+				continue
+			}
+			subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+			body, _ := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+			envelope.Subject = subject
+			envelope.Body = string(body)
+			server.Mutex.Lock()
+			server.Mails = append(server.Mails, envelope)
+			server.Mutex.Unlock()
+			reply("250 OK")
+		case command == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+func newEmailChannel(server *smtpServer) *Channel {
+	return &Channel{
+		Name:   "mail",
+		Type:   ChannelTypeEmail,
+		Server: "127.0.0.1",
+		Port:   server.port(),
+		From:   "Watcher <watcher@example.com>",
+		To:     []string{"ops@example.com", "Dev <dev@example.com>"},
+	}
+}
+
+func TestSendMail(t *testing.T) {
+	server := newSMTPServer(t, "250")
+	channel := newEmailChannel(server)
+	notification := &Notification{
+		Status:     AlertStateFiring,
+		Rule:       "backlog",
+		App:        "order",
+		Datasource: "MA-103",
+		Value:      8,
+		TimeStamp:  time.Now(),
+	}
+	err := channel.Send(context.Background(), notification)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mails := server.getMails()
+	if len(mails) != 1 {
+		t.Fatalf("unexpected mails %v", mails)
+	}
+	received := mails[0]
+	if received.From != "watcher@example.com" || strings.Join(received.To, ",") != "ops@example.com,dev@example.com" {
+		t.Errorf("unexpected envelope %s %v", received.From, received.To)
+	}
+	if received.Subject != "[告警] order backlog" {
+		t.Errorf("unexpected subject %s", received.Subject)
+	}
+	if !strings.Contains(received.Body, "数据源：MA-103") || !strings.Contains(received.Body, "当前值：8") {
+		t.Errorf("unexpected body %s", received.Body)
+	}
+}
+
+func TestSendMailRejected(t *testing.T) {
+	server := newSMTPServer(t, "550")
+	channel := newEmailChannel(server)
+	err := channel.SendMail(context.Background(), "subject", "body")
+	// 5xx永久错误不重试
+	if err == nil || !strings.Contains(err.Error(), "mailbox unavailable") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestSendDigest(t *testing.T) {
+	server := newSMTPServer(t, "250")
+	channel := newEmailChannel(server)
+	watchers := []*WatcherConfig{
+		{App: "order", Desc: "订单同步", Module: "MES", System: "WMS", Enabled: true, Latest: []ExpiredData{
+			{Datasource: "MA-103", Buckets: map[string]int{"Expire1Day": 3}, TimeStamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)},
+		}},
+		{App: "stock", Module: "MES", System: "WMS"},
+		{App: "bill", Module: "ERP", System: "FI", Enabled: true},
+	}
+	digest := NewDigest(watchers)
+	if len(digest.Groups) != 2 || digest.Groups[0].Module != "ERP" || len(digest.Groups[1].Watchers) != 2 {
+		t.Fatalf("unexpected groups %v", digest.Groups)
+	}
+	err := channel.SendDigest(context.Background(), digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mails := server.getMails()
+	if len(mails) != 1 {
+		t.Fatalf("unexpected mails %v", mails)
+	}
+	if mails[0].Subject != "呆滞数据汇总 "+digest.TimeStamp.Format("2006-01-02") {
+		t.Errorf("unexpected subject %s", mails[0].Subject)
+	}
+	body := mails[0].Body
+	for _, expected := range []string{
+		"[ERP / FI]",
+		"[MES / WMS]",
+		"- order 订单同步\n    MA-103：Expire1Day=3 （01-02 03:04:05）",
+		"- stock （未启用）\n    暂无数据",
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("body does not contain %q\n%s", expected, body)
+		}
+	}
+	if strings.Index(body, "[ERP / FI]") > strings.Index(body, "[MES / WMS]") {
+		t.Errorf("unexpected group order\n%s", body)
+	}
+}
@@ -0,0 +1,177 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var ErrPatternInvalid = errors.New("pattern is invalid")
+
+// Extend中保留的最旧文件数量
+const FilesystemOldestCount = 10
+
+// 滞留文件
+type StaleFile struct {
+	Name    string    // 相对扫描目录的路径
+	Size    int64     // 大小(byte)
+	ModTime time.Time // 修改时间
+	Age     int64     // 滞留时长(s)
+}
+
+// 校验filesystem数据源配置
+func (datasource *Datasource) validateFilesystem() error {
+	if datasource.Path == "" {
+		return fmt.Errorf("%w: filesystem datasource has no path", ErrDatasourceNotSupport)
+	}
+	err := ValidatePatterns(datasource.Patterns)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrDatasourceNotSupport, err)
+	}
+	return nil
+}
+
+// 校验文件匹配模式
+func ValidatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		_, err := filepath.Match(pattern, "")
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrPatternInvalid, pattern)
+		}
+	}
+	return nil
+}
+
+// 测试filesystem数据源，检查目录可读
+func (datasource *Datasource) testFilesystem(result *DatasourceTestResult) error {
+	result.DSN = datasource.Path
+	info, err := os.Stat(datasource.Path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return &datasourceConfigError{fmt.Errorf("%s is not a directory", datasource.Path)}
+	}
+	_, err = os.ReadDir(datasource.Path)
+	return err
+}
+
+// 扫描目录，返回匹配的文件及因无权限跳过的文件、目录数量
+func (datasource *Datasource) ScanFiles(patterns []string) ([]StaleFile, int, error) {
+	if len(patterns) == 0 {
+		patterns = datasource.Patterns
+	}
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	files := make([]StaleFile, 0)
+	skipped := 0
+	now := time.Now()
+	err := filepath.WalkDir(datasource.Path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			// 扫描目录本身不可读时返回错误，子目录及文件无权限时跳过
+			if path != datasource.Path && errors.Is(err, fs.ErrPermission) {
+				skipped++
+				return nil
+			}
+			if path != datasource.Path && errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if entry.IsDir() {
+			if path != datasource.Path && !datasource.Recursive {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		name, err := filepath.Rel(datasource.Path, path)
+		if err != nil {
+			return err
+		}
+		if !matchAny(patterns, name) {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// 扫描期间文件被移走
+			if os.IsNotExist(err) {
+				return nil
+			}
+			if errors.Is(err, fs.ErrPermission) {
+				skipped++
+				return nil
+			}
+			return err
+		}
+		files = append(files, StaleFile{
+			Name:    filepath.ToSlash(name),
+			Size:    info.Size(),
+			ModTime: info.ModTime().Local(),
+			Age:     int64(now.Sub(info.ModTime()).Seconds()),
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, skipped, err
+	}
+	return files, skipped, nil
+}
+
+// 匹配文件名或相对路径
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(name)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// 从目录获取数据，按文件滞留时长统计到分段
+func (watcher *WatcherConfig) GetExpiredDataFromFilesystem(datasource *Datasource) (*[]ExpiredData, error) {
+	files, skipped, err := datasource.ScanFiles(watcher.Patterns)
+	if err != nil {
+		return nil, err
+	}
+	buckets := watcher.GetBuckets()
+	data := ExpiredData{
+		Datasource:    datasource.Code,
+		WatcherConfig: watcher,
+		TimeStamp:     time.Now().Local(),
+		Buckets:       make(map[string]int, len(buckets)),
+	}
+	thresholds := watcher.GetBucketThresholds()
+	count := len(files)
+	var totalSize int64
+	for _, file := range files {
+		totalSize += file.Size
+		name := thresholds.BucketOf(time.Duration(file.Age) * time.Second)
+		if name != "" {
+			data.Buckets[name]++
+		}
+	}
+	data.FillBuckets(buckets)
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime.Before(files[j].ModTime)
+	})
+	if len(files) > FilesystemOldestCount {
+		files = files[:FilesystemOldestCount]
+	}
+	data.Extend = map[string]interface{}{
+		"Path":      datasource.Path,
+		"Count":     count,
+		"TotalSize": totalSize,
+		"Skipped":   skipped,
+		"Oldest":    files,
+	}
+	datas := []ExpiredData{data}
+	return &datas, nil
+}
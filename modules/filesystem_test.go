@@ -0,0 +1,99 @@
+package modules
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 创建文件并设置修改时间
+func writeStaleFile(t *testing.T, path string, age time.Duration) {
+	t.Helper()
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(path, []byte("data"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	err = os.Chtimes(path, mtime, mtime)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetExpiredDataFromFilesystem(t *testing.T) {
+	dir := t.TempDir()
+	day := 24 * time.Hour
+	writeStaleFile(t, filepath.Join(dir, "new.csv"), 2*time.Hour)
+	writeStaleFile(t, filepath.Join(dir, "a.csv"), 2*day)
+	writeStaleFile(t, filepath.Join(dir, "b.csv"), 10*day)
+	writeStaleFile(t, filepath.Join(dir, "c.csv"), 40*day)
+	writeStaleFile(t, filepath.Join(dir, "c.tmp"), 40*day)
+	writeStaleFile(t, filepath.Join(dir, "sub", "d.csv"), 3*day)
+	datasource := &Datasource{Code: "FS", Type: DatasourceTypeFilesystem, Path: dir, Patterns: []string{"*.csv"}}
+	watcher := &WatcherConfig{App: "fs"}
+
+	datas, err := watcher.GetExpiredDataFromFilesystem(datasource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := (*datas)[0]
+	if data.Expire1Day != 1 || data.Expire1Week != 1 || data.Expire1Month != 1 {
+		t.Errorf("unexpected buckets %v", data.Buckets)
+	}
+	extend := data.Extend.(map[string]interface{})
+	if extend["Count"] != 4 {
+		t.Errorf("unexpected count %v", extend["Count"])
+	}
+	if oldest := extend["Oldest"].([]StaleFile); oldest[0].Name != "c.csv" {
+		t.Errorf("unexpected oldest %v", oldest)
+	}
+
+	// 递归扫描，监控配置的匹配模式覆盖数据源配置
+	datasource.Recursive = true
+	watcher.Patterns = []string{"sub/*.csv"}
+	datas, err = watcher.GetExpiredDataFromFilesystem(datasource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = (*datas)[0]
+	if data.Expire1Day != 1 || data.Extend.(map[string]interface{})["Count"] != 1 {
+		t.Errorf("unexpected recursive result %v %v", data.Buckets, data.Extend)
+	}
+}
+
+func TestScanFilesSkipsUnreadable(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root ignores directory permissions")
+	}
+	dir := t.TempDir()
+	writeStaleFile(t, filepath.Join(dir, "a.csv"), time.Hour)
+	writeStaleFile(t, filepath.Join(dir, "locked", "b.csv"), time.Hour)
+	err := os.Chmod(filepath.Join(dir, "locked"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(filepath.Join(dir, "locked"), 0755)
+	datasource := &Datasource{Path: dir, Recursive: true}
+	files, skipped, err := datasource.ScanFiles(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || skipped != 1 {
+		t.Errorf("unexpected files %v skipped %d", files, skipped)
+	}
+}
+
+func TestValidatePatterns(t *testing.T) {
+	if err := ValidatePatterns([]string{"*.csv", "sub/*"}); err != nil {
+		t.Error(err)
+	}
+	if err := ValidatePatterns([]string{"[a-"}); !errors.Is(err, ErrPatternInvalid) {
+		t.Errorf("expected invalid pattern, got %v", err)
+	}
+}
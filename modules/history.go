@@ -0,0 +1,222 @@
+package modules
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+var (
+	RunTriggerCron    = "cron"
+	RunTriggerManual  = "manual"
+	RunTriggerPreview = "preview"
+)
+
+// 运行历史默认保存路径
+const HistoryDefaultPath = "./history.db"
+
+// 运行历史默认保留时长
+const HistoryDefaultRetention = "30d"
+
+// 运行历史清理间隔
+const HistoryPurgeInterval = time.Hour
+
+// 监控运行记录
+type WatcherRun struct {
+	ID       int64              // 编号
+	App      string             // 应用名称
+	Trigger  string             // 触发方式（cron/manual/preview）
+	Start    time.Time          // 开始时间
+	End      time.Time          // 结束时间
+	Duration int64              // 耗时(ms)
+	Rows     int                // 数据条数
+	Error    string             // 错误信息，多个数据源以换行分隔
+	Sources  []WatcherRunSource // 各数据源运行情况
+}
+
+// 数据源运行记录
+type WatcherRunSource struct {
+	Datasource string // 数据源编号
+	Duration   int64  // 耗时(ms)
+	Rows       int    // 数据条数
+	Error      string // 错误信息
+}
+
+func NewWatcherRun(app string, trigger string) *WatcherRun {
+	return &WatcherRun{
+		App:     app,
+		Trigger: trigger,
+		Start:   time.Now().Local(),
+		Sources: make([]WatcherRunSource, 0),
+	}
+}
+
+// 记录数据源运行结果
+func (run *WatcherRun) AddSource(datasource string, start time.Time, datas *[]ExpiredData, err error) *WatcherRunSource {
+	source := WatcherRunSource{
+		Datasource: datasource,
+		Duration:   time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		source.Error = err.Error()
+	} else if datas != nil {
+		source.Rows = len(*datas)
+	}
+	run.Sources = append(run.Sources, source)
+	return &run.Sources[len(run.Sources)-1]
+}
+
+// 结束运行，汇总条数及错误
+func (run *WatcherRun) Finish() {
+	run.End = time.Now().Local()
+	run.Duration = run.End.Sub(run.Start).Milliseconds()
+	errs := make([]string, 0)
+	for _, source := range run.Sources {
+		run.Rows += source.Rows
+		if source.Error != "" {
+			errs = append(errs, source.Datasource+": "+source.Error)
+		}
+	}
+	run.Error = strings.Join(errs, "\n")
+}
+
+// 运行历史，保存在内置SQLite数据库
+type History struct {
+	Path      string  `yaml:"Path,omitempty"`      // 数据库文件路径，默认./history.db
+	Retention string  `yaml:"Retention,omitempty"` // 保留时长，如30d、72h，默认30d
+	DB        *sql.DB `yaml:"-" json:"-"`          // 数据库连接
+}
+
+func (history *History) getPath() string {
+	if history.Path == "" {
+		return HistoryDefaultPath
+	}
+	return history.Path
+}
+
+func (history *History) getRetention() time.Duration {
+	retention := history.Retention
+	if retention == "" {
+		retention = HistoryDefaultRetention
+	}
+	dur, err := ParseThreshold(retention)
+	if err != nil || dur <= 0 {
+		dur, _ = ParseThreshold(HistoryDefaultRetention)
+	}
+	return dur
+}
+
+// 打开数据库并定期清理过期记录
+func (history *History) Init() error {
+	db, err := sql.Open("sqlite", history.getPath()+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return err
+	}
+	// 单连接写入，避免database is locked
+	db.SetMaxOpenConns(1)
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		app TEXT NOT NULL,
+		trigger TEXT NOT NULL,
+		start_at INTEGER NOT NULL,
+		end_at INTEGER NOT NULL,
+		duration INTEGER NOT NULL,
+		rows INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		sources TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS idx_runs_app_start ON runs (app, start_at);
+	CREATE INDEX IF NOT EXISTS idx_runs_start ON runs (start_at);`)
+	if err != nil {
+		db.Close()
+		return err
+	}
+	history.DB = db
+	go func() {
+		for {
+			_, err := history.Purge()
+			if err != nil {
+				log.Printf("Purge run history failed: %v", err)
+			}
+			time.Sleep(HistoryPurgeInterval)
+		}
+	}()
+	return nil
+}
+
+// 保存运行记录，数据库未打开时忽略
+func (history *History) Save(run *WatcherRun) error {
+	if history == nil || history.DB == nil {
+		return nil
+	}
+	sources, err := json.Marshal(run.Sources)
+	if err != nil {
+		return err
+	}
+	res, err := history.DB.Exec(
+		"INSERT INTO runs (app, trigger, start_at, end_at, duration, rows, error, sources) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		run.App, run.Trigger, run.Start.UnixMilli(), run.End.UnixMilli(), run.Duration, run.Rows, run.Error, string(sources),
+	)
+	if err != nil {
+		return err
+	}
+	run.ID, _ = res.LastInsertId()
+	return nil
+}
+
+// 分页获取监控运行记录，按开始时间倒序，page从1开始
+func (history *History) GetRuns(app string, page int, size int) (*PagedList[WatcherRun], error) {
+	if history == nil || history.DB == nil {
+		return nil, errors.New("run history is not available")
+	}
+	var total int32
+	err := history.DB.QueryRow("SELECT COUNT(1) FROM runs WHERE app = ?", app).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := history.DB.Query(
+		"SELECT id, app, trigger, start_at, end_at, duration, rows, error, sources FROM runs WHERE app = ? ORDER BY start_at DESC, id DESC LIMIT ? OFFSET ?",
+		app, size, (page-1)*size,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := &PagedList[WatcherRun]{
+		Items: make([]WatcherRun, 0, size),
+		Total: total,
+	}
+	for rows.Next() {
+		var run WatcherRun
+		var start, end int64
+		var sources string
+		err = rows.Scan(&run.ID, &run.App, &run.Trigger, &start, &end, &run.Duration, &run.Rows, &run.Error, &sources)
+		if err != nil {
+			return nil, err
+		}
+		run.Start = time.UnixMilli(start).Local()
+		run.End = time.UnixMilli(end).Local()
+		err = json.Unmarshal([]byte(sources), &run.Sources)
+		if err != nil {
+			return nil, err
+		}
+		list.Items = append(list.Items, run)
+	}
+	return list, rows.Err()
+}
+
+// 清理超过保留时长的记录
+func (history *History) Purge() (int64, error) {
+	if history == nil || history.DB == nil {
+		return 0, nil
+	}
+	before := time.Now().Add(-history.getRetention()).UnixMilli()
+	res, err := history.DB.Exec("DELETE FROM runs WHERE start_at < ?", before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
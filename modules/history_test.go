@@ -0,0 +1,126 @@
+package modules
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 在临时目录中打开运行历史
+func newTestHistory(t *testing.T, retention string) *History {
+	t.Helper()
+	history := &History{Path: filepath.Join(t.TempDir(), "history.db"), Retention: retention}
+	err := history.Init()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		history.DB.Close()
+	})
+	return history
+}
+
+// 保存指定开始时间的运行记录
+func saveTestRun(t *testing.T, history *History, app string, start time.Time) *WatcherRun {
+	t.Helper()
+	run := &WatcherRun{
+		App:      app,
+		Trigger:  RunTriggerCron,
+		Start:    start,
+		End:      start.Add(time.Second),
+		Duration: 1000,
+		Rows:     2,
+		Sources:  []WatcherRunSource{{Datasource: "MA-103", Duration: 1000, Rows: 2}},
+	}
+	err := history.Save(run)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.ID == 0 {
+		t.Fatal("run id is not set")
+	}
+	return run
+}
+
+func TestHistoryGetRuns(t *testing.T) {
+	history := newTestHistory(t, "")
+	now := time.Now().Truncate(time.Millisecond)
+	for i := 0; i < 5; i++ {
+		saveTestRun(t, history, "order", now.Add(time.Duration(i)*time.Minute))
+	}
+	saveTestRun(t, history, "stock", now)
+
+	// 按开始时间倒序分页
+	list, err := history.GetRuns("order", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 5 || len(list.Items) != 2 {
+		t.Fatalf("unexpected page total %d items %d", list.Total, len(list.Items))
+	}
+	if !list.Items[0].Start.Equal(now.Add(4*time.Minute)) || !list.Items[1].Start.Equal(now.Add(3*time.Minute)) {
+		t.Errorf("unexpected order %v %v", list.Items[0].Start, list.Items[1].Start)
+	}
+	first := list.Items[0]
+	if first.App != "order" || first.Trigger != RunTriggerCron || first.Rows != 2 || len(first.Sources) != 1 || first.Sources[0].Datasource != "MA-103" {
+		t.Errorf("unexpected run %+v", first)
+	}
+
+	list, err = history.GetRuns("order", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 5 || len(list.Items) != 1 || !list.Items[0].Start.Equal(now) {
+		t.Errorf("unexpected last page %+v", list)
+	}
+	list, err = history.GetRuns("unknown", 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 0 || len(list.Items) != 0 {
+		t.Errorf("unexpected runs of unknown app %+v", list)
+	}
+}
+
+func TestHistoryPurge(t *testing.T) {
+	history := newTestHistory(t, "1d")
+	now := time.Now()
+	saveTestRun(t, history, "order", now.Add(-48*time.Hour))
+	saveTestRun(t, history, "order", now.Add(-25*time.Hour))
+	kept := saveTestRun(t, history, "order", now.Add(-time.Hour))
+	_, err := history.Purge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := history.GetRuns("order", 1, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if list.Total != 1 || len(list.Items) != 1 || list.Items[0].ID != kept.ID {
+		t.Errorf("unexpected runs after purge %+v", list)
+	}
+}
+
+func TestWatcherRunFinish(t *testing.T) {
+	run := NewWatcherRun("order", RunTriggerManual)
+	start := time.Now()
+	datas := []ExpiredData{{Datasource: "MA-103"}, {Datasource: "MA-103"}}
+	run.AddSource("MA-103", start, &datas, nil)
+	run.AddSource("MA-104", start, nil, errors.New("connection refused"))
+	run.AddSource("MA-105", start, &[]ExpiredData{{Datasource: "MA-105"}}, nil)
+	run.AddSource("MA-106", start, nil, errors.New("timeout"))
+	run.Finish()
+	if run.Rows != 3 {
+		t.Errorf("unexpected rows %d", run.Rows)
+	}
+	if run.Error != "MA-104: connection refused\nMA-106: timeout" {
+		t.Errorf("unexpected error %q", run.Error)
+	}
+	if run.End.Before(run.Start) || run.Duration < 0 {
+		t.Errorf("unexpected end %v start %v", run.End, run.Start)
+	}
+	if len(run.Sources) != 4 || run.Sources[1].Rows != 0 || run.Sources[1].Error != "connection refused" {
+		t.Errorf("unexpected sources %+v", run.Sources)
+	}
+}
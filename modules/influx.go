@@ -0,0 +1,346 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrSinkQueueFull = errors.New("sink queue is full")
+
+// InfluxDB默认measurement
+const InfluxDefaultMeasurement = "expired_data"
+
+// 输出批量写入默认条数
+const SinkDefaultBatchSize = 500
+
+// 输出批量写入默认间隔
+const SinkDefaultFlushInterval = 5 * time.Second
+
+// 输出缓冲默认容量，超出时丢弃新数据
+const SinkDefaultQueueSize = 10000
+
+// 输出写入失败默认重试次数
+const SinkDefaultRetries = 3
+
+// 输出请求默认超时时间
+const SinkDefaultTimeout = 10 * time.Second
+
+func (conf *SinkConfig) getBatchSize() int {
+	if conf.BatchSize <= 0 {
+		return SinkDefaultBatchSize
+	}
+	return conf.BatchSize
+}
+
+func (conf *SinkConfig) getFlushInterval() time.Duration {
+	if conf.FlushInterval <= 0 {
+		return SinkDefaultFlushInterval
+	}
+	return time.Duration(conf.FlushInterval) * time.Second
+}
+
+func (conf *SinkConfig) getQueueSize() int {
+	if conf.QueueSize <= 0 {
+		return SinkDefaultQueueSize
+	}
+	return conf.QueueSize
+}
+
+func (conf *SinkConfig) getRetries() int {
+	if conf.Retries == nil {
+		return SinkDefaultRetries
+	}
+	return *conf.Retries
+}
+
+func (conf *SinkConfig) getTimeout() time.Duration {
+	if conf.Timeout <= 0 {
+		return SinkDefaultTimeout
+	}
+	return time.Duration(conf.Timeout) * time.Second
+}
+
+// 校验InfluxDB输出配置，配置Database时使用1.x的/write接口，否则使用2.x的/api/v2/write接口
+func (conf *SinkConfig) validateInflux() error {
+	u, err := url.Parse(conf.Url)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("%w: sink %s has invalid url %s", ErrSinkNotSupport, conf.Name, conf.Url)
+	}
+	if conf.Database == "" && conf.Bucket == "" {
+		return fmt.Errorf("%w: sink %s has no database or bucket", ErrSinkNotSupport, conf.Name)
+	}
+	return nil
+}
+
+// 生成写入地址，时间精度为毫秒
+func (conf *SinkConfig) getInfluxWriteUrl() string {
+	u, _ := url.Parse(conf.Url)
+	query := url.Values{}
+	query.Set("precision", "ms")
+	if conf.Database != "" {
+		u.Path = strings.TrimRight(u.Path, "/") + "/write"
+		query.Set("db", conf.Database)
+	} else {
+		u.Path = strings.TrimRight(u.Path, "/") + "/api/v2/write"
+		query.Set("org", conf.Org)
+		query.Set("bucket", conf.Bucket)
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// 以行协议写入InfluxDB，按条数或间隔批量写入
+type InfluxSink struct {
+	Config *SinkConfig
+	Client *http.Client
+	mutex  sync.Mutex
+	lines  []string
+	flush  chan struct{}
+}
+
+func NewInfluxSink(conf *SinkConfig) *InfluxSink {
+	sink := &InfluxSink{
+		Config: conf,
+		Client: &http.Client{Timeout: conf.getTimeout()},
+		lines:  make([]string, 0),
+		flush:  make(chan struct{}, 1),
+	}
+	go sink.run()
+	return sink
+}
+
+func (sink *InfluxSink) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	measurement := sink.Config.Measurement
+	if measurement == "" {
+		measurement = InfluxDefaultMeasurement
+	}
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	dropped := 0
+	for i := range datas {
+		line := InfluxLine(measurement, watcher, &datas[i])
+		if line == "" {
+			continue
+		}
+		if len(sink.lines) >= sink.Config.getQueueSize() {
+			dropped++
+			continue
+		}
+		sink.lines = append(sink.lines, line)
+	}
+	if len(sink.lines) >= sink.Config.getBatchSize() {
+		select {
+		case sink.flush <- struct{}{}:
+		default:
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%w: %d lines dropped", ErrSinkQueueFull, dropped)
+	}
+	return nil
+}
+
+// 按条数或间隔写入缓冲的数据
+func (sink *InfluxSink) run() {
+	ticker := time.NewTicker(sink.Config.getFlushInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-sink.flush:
+		}
+		for {
+			sink.mutex.Lock()
+			n := min(len(sink.lines), sink.Config.getBatchSize())
+			batch := sink.lines[:n]
+			sink.lines = sink.lines[n:]
+			sink.mutex.Unlock()
+			if n == 0 {
+				break
+			}
+			err := sink.send(batch)
+			if err != nil {
+				metricSinkFailures.WithLabelValues(sink.Config.Name).Inc()
+				log.Printf("Write %d lines to influxdb sink %s failed: %v", n, sink.Config.Name, err)
+			}
+		}
+	}
+}
+
+// 发送一批数据，网络错误、429及5xx按配置次数退避重试，400时拆分批次，仅丢弃无法写入的行
+func (sink *InfluxSink) send(lines []string) error {
+	body := []byte(strings.Join(lines, "\n") + "\n")
+	retries := sink.Config.getRetries()
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retryable bool
+		retryable, err = sink.post(body)
+		var statusErr *influxStatusError
+		if len(lines) > 1 && errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusBadRequest {
+			// 部分写入时有效行已写入，同一时间戳重复写入为覆盖
+			mid := len(lines) / 2
+			return errors.Join(sink.send(lines[:mid]), sink.send(lines[mid:]))
+		}
+		if err == nil || !retryable || attempt >= retries {
+			return err
+		}
+		time.Sleep(time.Duration(500<<attempt) * time.Millisecond)
+	}
+}
+
+// InfluxDB返回错误状态
+type influxStatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *influxStatusError) Error() string {
+	return fmt.Sprintf("status %d: %s", e.StatusCode, e.Message)
+}
+
+// 发送一次写入请求，返回错误是否可重试
+func (sink *InfluxSink) post(body []byte) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), sink.Config.getTimeout())
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sink.Config.getInfluxWriteUrl(), bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if sink.Config.Token != "" {
+		req.Header.Set("Authorization", "Token "+sink.Config.Token)
+	} else if sink.Config.Username != "" {
+		req.SetBasicAuth(sink.Config.Username, sink.Config.Password)
+	}
+	res, err := sink.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		io.Copy(io.Discard, res.Body)
+		return false, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	err = &influxStatusError{res.StatusCode, string(message)}
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `, "\n", `\n`)
+	influxKeyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+)
+
+// 生成行协议，应用、数据源、模块、系统及标签为tag，分段数量为整数field，Extend中的数值为浮点field，无field时返回空串
+func InfluxLine(measurement string, watcher *WatcherConfig, data *ExpiredData) string {
+	tags := map[string]string{
+		"App":        watcher.App,
+		"Datasource": data.Datasource,
+		"Module":     watcher.Module,
+		"System":     watcher.System,
+		"Tags":       strings.Join(watcher.Tags, ","),
+	}
+	fields := map[string]string{}
+	if data.Buckets != nil {
+		for name, count := range data.Buckets {
+			fields[name] = strconv.Itoa(count) + "i"
+		}
+	} else {
+		fields[BucketExpire1Day] = strconv.Itoa(data.Expire1Day) + "i"
+		fields[BucketExpire1Week] = strconv.Itoa(data.Expire1Week) + "i"
+		fields[BucketExpire1Month] = strconv.Itoa(data.Expire1Month) + "i"
+	}
+	influxFields(fields, "Extend", data.Extend)
+	if len(fields) == 0 {
+		return ""
+	}
+	var line strings.Builder
+	line.WriteString(influxMeasurementEscaper.Replace(measurement))
+	for _, key := range sortedKeys(tags) {
+		if tags[key] == "" {
+			continue
+		}
+		line.WriteString("," + influxKeyEscaper.Replace(key) + "=" + influxKeyEscaper.Replace(tags[key]))
+	}
+	for i, key := range sortedKeys(fields) {
+		if i == 0 {
+			line.WriteString(" ")
+		} else {
+			line.WriteString(",")
+		}
+		line.WriteString(influxKeyEscaper.Replace(key) + "=" + fields[key])
+	}
+	line.WriteString(" " + strconv.FormatInt(data.TimeStamp.UnixMilli(), 10))
+	return line.String()
+}
+
+// 递归提取数值，键以“.”号拼接，数值统一写为浮点数，避免同一field在不同批次中类型不一致
+func influxFields(fields map[string]string, prefix string, val interface{}) {
+	switch v := val.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			influxFields(fields, prefix+"."+key, child)
+		}
+	case *interface{}:
+		influxFields(fields, prefix, *v)
+	case float64:
+		if !math.IsNaN(v) && !math.IsInf(v, 0) {
+			fields[prefix] = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+	case float32:
+		influxFields(fields, prefix, float64(v))
+	case int:
+		influxFields(fields, prefix, float64(v))
+	case int8:
+		influxFields(fields, prefix, float64(v))
+	case int16:
+		influxFields(fields, prefix, float64(v))
+	case int32:
+		influxFields(fields, prefix, float64(v))
+	case int64:
+		influxFields(fields, prefix, float64(v))
+	case uint:
+		influxFields(fields, prefix, float64(v))
+	case uint8:
+		influxFields(fields, prefix, float64(v))
+	case uint16:
+		influxFields(fields, prefix, float64(v))
+	case uint32:
+		influxFields(fields, prefix, float64(v))
+	case uint64:
+		influxFields(fields, prefix, float64(v))
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			influxFields(fields, prefix, f)
+		}
+	case []byte:
+		influxFields(fields, prefix, string(v))
+	case string:
+		// 数据库驱动以字符串或[]byte返回DECIMAL等数值
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			influxFields(fields, prefix, f)
+		}
+	}
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
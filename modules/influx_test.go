@@ -0,0 +1,75 @@
+package modules
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInfluxLine(t *testing.T) {
+	watcher := &WatcherConfig{
+		App:    "Order Sync",
+		Module: "MES",
+		System: "WMS,ERP",
+		Tags:   []string{"plant=1", "line"},
+	}
+	data := &ExpiredData{
+		Datasource: "NB-146",
+		TimeStamp:  time.UnixMilli(1700000000123),
+		Buckets:    map[string]int{"Expire1Day": 3, "Expire1Week": 1},
+		Extend: map[string]interface{}{
+			"Amount": 12.5,
+			"Order":  map[string]interface{}{"Count": int64(7), "No": "SO-1"},
+			"Price":  []byte("3.50"),
+			"Qty":    " 12 ",
+			"Remark": "text",
+		},
+	}
+	line := InfluxLine("expired data", watcher, data)
+	expected := `expired\ data,App=Order\ Sync,Datasource=NB-146,Module=MES,System=WMS\,ERP,Tags=plant\=1\,line ` +
+		`Expire1Day=3i,Expire1Week=1i,Extend.Amount=12.5,Extend.Order.Count=7,Extend.Price=3.5,Extend.Qty=12 1700000000123`
+	if line != expected {
+		t.Errorf("unexpected line\n%s\nexpected\n%s", line, expected)
+	}
+}
+
+func TestInfluxWriteUrl(t *testing.T) {
+	v1 := &SinkConfig{Url: "http://127.0.0.1:8086/", Database: "plant"}
+	if url := v1.getInfluxWriteUrl(); url != "http://127.0.0.1:8086/write?db=plant&precision=ms" {
+		t.Errorf("unexpected v1 url %s", url)
+	}
+	v2 := &SinkConfig{Url: "http://127.0.0.1:8086", Org: "aux", Bucket: "watcher"}
+	if url := v2.getInfluxWriteUrl(); url != "http://127.0.0.1:8086/api/v2/write?bucket=watcher&org=aux&precision=ms" {
+		t.Errorf("unexpected v2 url %s", url)
+	}
+}
+
+func TestInfluxSendSplitsBadRequest(t *testing.T) {
+	written := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "bad") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"code":"invalid","message":"unable to parse"}`))
+			return
+		}
+		written = append(written, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+	retries := 0
+	sink := &InfluxSink{
+		Config: &SinkConfig{Name: "influx", Url: server.URL, Bucket: "watcher", Retries: &retries},
+		Client: server.Client(),
+	}
+	err := sink.send([]string{"m a=1 1", "m a=2 2", "m bad 3", "m a=4 4", "m a=5 5"})
+	if err == nil || strings.Count(err.Error(), "status 400") != 1 {
+		t.Errorf("unexpected error %v", err)
+	}
+	if strings.Join(written, ",") != "m a=1 1,m a=2 2,m a=4 4,m a=5 5" {
+		t.Errorf("unexpected written lines %v", written)
+	}
+}
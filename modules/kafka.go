@@ -0,0 +1,289 @@
+package modules
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kgo"
+	"github.com/twmb/franz-go/pkg/sasl/plain"
+	"github.com/twmb/franz-go/pkg/sasl/scram"
+)
+
+var ErrKafkaTopicInvalid = errors.New("kafka topic is invalid")
+
+// Kafka结果默认主题模板
+const KafkaDefaultTopic = "datawatcher"
+
+// Kafka默认客户端编号
+const KafkaDefaultClientID = "datawatcher"
+
+var (
+	KafkaCompressionNone   = "none"
+	KafkaCompressionGzip   = "gzip"
+	KafkaCompressionSnappy = "snappy"
+	KafkaCompressionZstd   = "zstd"
+)
+
+var (
+	KafkaSASLPlain       = "plain"
+	KafkaSASLScramSHA256 = "scram-sha-256"
+	KafkaSASLScramSHA512 = "scram-sha-512"
+)
+
+var (
+	kafkaTopicVariable = regexp.MustCompile(`\{\w+\}`)
+	kafkaTopicPattern  = regexp.MustCompile(`^[a-zA-Z0-9._-]*$`)
+	kafkaTopicEscaper  = regexp.MustCompile(`[^a-zA-Z0-9._-]`)
+)
+
+// 校验Kafka输出配置
+func (conf *SinkConfig) validateKafka() error {
+	if len(conf.Brokers) == 0 {
+		return fmt.Errorf("%w: sink %s has no brokers", ErrSinkNotSupport, conf.Name)
+	}
+	for _, broker := range conf.Brokers {
+		_, _, err := net.SplitHostPort(broker)
+		if err != nil {
+			return fmt.Errorf("%w: sink %s has invalid broker %s", ErrSinkNotSupport, conf.Name, broker)
+		}
+	}
+	switch strings.ToLower(conf.Compression) {
+	case "", KafkaCompressionNone, KafkaCompressionGzip, KafkaCompressionSnappy, KafkaCompressionZstd:
+	default:
+		return fmt.Errorf("%w: sink %s has invalid compression %s", ErrSinkNotSupport, conf.Name, conf.Compression)
+	}
+	switch strings.ToLower(conf.SASL) {
+	case "":
+	case KafkaSASLPlain, KafkaSASLScramSHA256, KafkaSASLScramSHA512:
+		if conf.Username == "" {
+			return fmt.Errorf("%w: sink %s has no username", ErrSinkNotSupport, conf.Name)
+		}
+	default:
+		return fmt.Errorf("%w: sink %s has invalid sasl mechanism %s", ErrSinkNotSupport, conf.Name, conf.SASL)
+	}
+	if ValidateKafkaTopic(conf.Topic) != nil {
+		return fmt.Errorf("%w: sink %s has invalid topic %s", ErrSinkNotSupport, conf.Name, conf.Topic)
+	}
+	_, err := conf.getKafkaTLSConfig()
+	if err != nil {
+		return fmt.Errorf("%w: sink %s %s", ErrSinkNotSupport, conf.Name, err.Error())
+	}
+	return nil
+}
+
+// 校验主题模板，变量以外仅允许字母、数字及“._-”
+func ValidateKafkaTopic(template string) error {
+	if !kafkaTopicPattern.MatchString(kafkaTopicVariable.ReplaceAllString(template, "")) {
+		return fmt.Errorf("%w: %s", ErrKafkaTopicInvalid, template)
+	}
+	return nil
+}
+
+// 生成TLS配置，配置证书、跳过校验或TLS时启用
+func (conf *SinkConfig) getKafkaTLSConfig() (*tls.Config, error) {
+	config, err := conf.getTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if config == nil && conf.TLS {
+		config = &tls.Config{}
+	}
+	return config, nil
+}
+
+func (conf *SinkConfig) getKafkaCodec() kgo.CompressionCodec {
+	switch strings.ToLower(conf.Compression) {
+	case KafkaCompressionGzip:
+		return kgo.GzipCompression()
+	case KafkaCompressionSnappy:
+		return kgo.SnappyCompression()
+	case KafkaCompressionZstd:
+		return kgo.ZstdCompression()
+	default:
+		return kgo.NoCompression()
+	}
+}
+
+// 生成客户端配置，写入失败由客户端按配置次数退避重试，写入确认需全部同步副本应答
+func (conf *SinkConfig) getKafkaOptions() ([]kgo.Opt, error) {
+	opts := []kgo.Opt{
+		kgo.SeedBrokers(conf.Brokers...),
+		kgo.ClientID(conf.getClientID()),
+		kgo.ProducerBatchCompression(conf.getKafkaCodec()),
+		kgo.AllowAutoTopicCreation(),
+		kgo.DialTimeout(conf.getTimeout()),
+		kgo.ProduceRequestTimeout(conf.getTimeout()),
+		kgo.RecordRetries(conf.getRetries()),
+		kgo.RecordDeliveryTimeout(time.Duration(conf.getRetries()+1) * conf.getTimeout()),
+	}
+	tlsConfig, err := conf.getKafkaTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig != nil {
+		opts = append(opts, kgo.DialTLSConfig(tlsConfig))
+	}
+	switch strings.ToLower(conf.SASL) {
+	case KafkaSASLPlain:
+		opts = append(opts, kgo.SASL(plain.Auth{User: conf.Username, Pass: conf.Password}.AsMechanism()))
+	case KafkaSASLScramSHA256:
+		opts = append(opts, kgo.SASL(scram.Auth{User: conf.Username, Pass: conf.Password}.AsSha256Mechanism()))
+	case KafkaSASLScramSHA512:
+		opts = append(opts, kgo.SASL(scram.Auth{User: conf.Username, Pass: conf.Password}.AsSha512Mechanism()))
+	}
+	return opts, nil
+}
+
+func (conf *SinkConfig) getClientID() string {
+	if conf.ClientID == "" {
+		return KafkaDefaultClientID
+	}
+	return conf.ClientID
+}
+
+// 渲染主题模板，变量中不合法的字符替换为“_”，空值替换为“_”
+func KafkaTopic(template string, vars map[string]string) string {
+	return kafkaTopicVariable.ReplaceAllStringFunc(template, func(name string) string {
+		val, ok := vars[name[1:len(name)-1]]
+		if !ok {
+			return name
+		}
+		val = kafkaTopicEscaper.ReplaceAllString(val, "_")
+		if val == "" {
+			val = "_"
+		}
+		return val
+	})
+}
+
+// 消息键，由应用名称及数据源编号组成，按键哈希选择分区（与Java客户端默认分区一致），同一数据源的结果写入同一分区
+func KafkaKey(app string, datasource string) []byte {
+	return []byte(app + "/" + datasource)
+}
+
+// 以json写入Kafka，按条数或间隔批量写入，主题可由监控配置覆盖
+type KafkaSink struct {
+	Config  *SinkConfig
+	client  *kgo.Client
+	mutex   sync.Mutex
+	records []*kgo.Record
+	flush   chan struct{}
+}
+
+// 创建Kafka输出，连接及元数据在首次写入时获取，不阻塞启动
+func NewKafkaSink(conf *SinkConfig) (*KafkaSink, error) {
+	opts, err := conf.getKafkaOptions()
+	if err != nil {
+		return nil, err
+	}
+	client, err := kgo.NewClient(opts...)
+	if err != nil {
+		return nil, err
+	}
+	sink := &KafkaSink{
+		Config:  conf,
+		client:  client,
+		records: make([]*kgo.Record, 0),
+		flush:   make(chan struct{}, 1),
+	}
+	go sink.run()
+	return sink, nil
+}
+
+func (sink *KafkaSink) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	template := watcher.Topic
+	if template == "" {
+		template = sink.Config.Topic
+	}
+	if template == "" {
+		template = KafkaDefaultTopic
+	}
+	vars := watcherTopicVars(watcher)
+	sink.mutex.Lock()
+	defer sink.mutex.Unlock()
+	dropped := 0
+	for _, data := range datas {
+		if len(sink.records) >= sink.Config.getQueueSize() {
+			dropped++
+			continue
+		}
+		value, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		vars["Datasource"] = data.Datasource
+		at := data.TimeStamp
+		if at.IsZero() {
+			at = time.Now()
+		}
+		sink.records = append(sink.records, &kgo.Record{
+			Topic:     KafkaTopic(template, vars),
+			Key:       KafkaKey(watcher.App, data.Datasource),
+			Value:     value,
+			Timestamp: at,
+		})
+	}
+	if len(sink.records) >= sink.Config.getBatchSize() {
+		select {
+		case sink.flush <- struct{}{}:
+		default:
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%w: %d messages dropped", ErrSinkQueueFull, dropped)
+	}
+	return nil
+}
+
+// 按条数或间隔写入缓冲的消息
+func (sink *KafkaSink) run() {
+	ticker := time.NewTicker(sink.Config.getFlushInterval())
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-sink.flush:
+		}
+		for {
+			sink.mutex.Lock()
+			n := min(len(sink.records), sink.Config.getBatchSize())
+			batch := sink.records[:n]
+			sink.records = sink.records[n:]
+			sink.mutex.Unlock()
+			if n == 0 {
+				break
+			}
+			err := sink.send(batch)
+			if err != nil {
+				metricSinkFailures.WithLabelValues(sink.Config.Name).Inc()
+				log.Printf("Write %d messages to kafka sink %s failed: %v", n, sink.Config.Name, err)
+			}
+		}
+	}
+}
+
+// 发送一批消息，等待全部消息写入或失败
+func (sink *KafkaSink) send(records []*kgo.Record) error {
+	results := sink.client.ProduceSync(context.Background(), records...)
+	failed := 0
+	var err error
+	for _, result := range results {
+		if result.Err != nil {
+			failed++
+			err = result.Err
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d messages not written: %w", failed, err)
+	}
+	return nil
+}
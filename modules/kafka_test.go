@@ -0,0 +1,114 @@
+package modules
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kfake"
+	"github.com/twmb/franz-go/pkg/kgo"
+)
+
+func TestKafkaTopic(t *testing.T) {
+	topic := KafkaTopic("datawatcher.{System}.{App}.{Unknown}", map[string]string{
+		"App":    "Order Sync/MES",
+		"System": "",
+	})
+	if topic != "datawatcher._.Order_Sync_MES.{Unknown}" {
+		t.Errorf("unexpected topic %s", topic)
+	}
+	conf := &SinkConfig{Name: "kafka", Type: SinkTypeKafka, Brokers: []string{"127.0.0.1:9092"}, Topic: "watcher/{App}"}
+	if err := conf.Validate(); err == nil {
+		t.Error("expected invalid topic error")
+	}
+	conf.Topic = "watcher.{App}"
+	conf.Compression = "lz4"
+	if err := conf.Validate(); err == nil {
+		t.Error("expected invalid compression error")
+	}
+	conf.Compression = "gzip"
+	if err := conf.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestKafkaSinkProduce(t *testing.T) {
+	cluster, err := kfake.NewCluster(
+		kfake.NumBrokers(1),
+		kfake.AllowAutoTopicCreation(),
+		kfake.DefaultNumPartitions(4),
+		kfake.EnableSASL(),
+		kfake.Superuser("SCRAM-SHA-256", "watcher", "secret"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cluster.Close()
+	conf := &SinkConfig{
+		Name:        "test",
+		Type:        SinkTypeKafka,
+		Brokers:     cluster.ListenAddrs(),
+		Topic:       "datawatcher.{App}",
+		Compression: KafkaCompressionGzip,
+		SASL:        KafkaSASLScramSHA256,
+		Username:    "watcher",
+		Password:    "secret",
+		BatchSize:   3,
+	}
+	sink, err := conf.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	watcher := &WatcherConfig{App: "order"}
+	err = sink.Write(watcher, []ExpiredData{
+		{Datasource: "A", Buckets: map[string]int{"Expire1Day": 5}},
+		{Datasource: "B", Buckets: map[string]int{"Expire1Day": 7}},
+		{Datasource: "A", Buckets: map[string]int{"Expire1Day": 6}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts, err := conf.getKafkaOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	consumer, err := kgo.NewClient(append(opts,
+		kgo.ConsumeTopics("datawatcher.order"),
+		kgo.ConsumeResetOffset(kgo.NewOffset().AtStart()),
+	)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer consumer.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	records := make([]*kgo.Record, 0)
+	for len(records) < 3 {
+		fetches := consumer.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("records not received, got %d", len(records))
+		}
+		records = append(records, fetches.Records()...)
+	}
+	partitions := map[string]int32{}
+	counts := map[string][]int{}
+	for _, record := range records {
+		var data ExpiredData
+		err := json.Unmarshal(record.Value, &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key := string(record.Key)
+		if partition, ok := partitions[key]; ok && partition != record.Partition {
+			t.Errorf("key %s written to partitions %d and %d", key, partition, record.Partition)
+		}
+		partitions[key] = record.Partition
+		counts[key] = append(counts[key], data.Buckets["Expire1Day"])
+	}
+	// 同一数据源写入同一分区，保持写入顺序
+	if len(counts["order/A"]) != 2 || counts["order/A"][0] != 5 || counts["order/A"][1] != 6 || len(counts["order/B"]) != 1 {
+		t.Errorf("unexpected records %v", counts)
+	}
+}
@@ -0,0 +1,161 @@
+package modules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/PaesslerAG/gval"
+	"github.com/PaesslerAG/jsonpath"
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+var ErrMappingInvalid = errors.New("mapping is invalid")
+
+// 响应映射，将任意JSON（api）或XML（soap）响应映射为呆滞数据
+type ResponseMapping struct {
+	Root   string            `yaml:"Root,omitempty"` // 根数组路径，api为JSONPath，如$.data.items，soap为XPath，如//*[local-name()='Item']，为空时使用响应本身
+	Fields map[string]string `yaml:"Fields"`         // 字段路径，相对数组元素，键为呆滞数据字段名，扩展字段以“Extend.”为前缀，如Extend.Site: $.site
+}
+
+// soap数据源未配置映射时，按元素名称查找过期数量
+var DefaultXMLMapping = &ResponseMapping{
+	Fields: map[string]string{
+		"Expire1Day":   "//*[local-name()='Expire1Day']",
+		"Expire1Week":  "//*[local-name()='Expire1Week']",
+		"Expire1Month": "//*[local-name()='Expire1Month']",
+	},
+}
+
+// 按数据源类型校验映射表达式，仅api及soap数据源使用映射
+func (mapping *ResponseMapping) Validate(datasourceType string) error {
+	switch datasourceType {
+	case DatasourceTypeAPI:
+		return mapping.ValidateJSONPath()
+	case DatasourceTypeSOAP:
+		return mapping.ValidateXPath()
+	}
+	return nil
+}
+
+// 校验XPath表达式
+func (mapping *ResponseMapping) ValidateXPath() error {
+	if mapping.Root != "" {
+		_, err := xpath.Compile(mapping.Root)
+		if err != nil {
+			return fmt.Errorf("%w: root %s: %w", ErrMappingInvalid, mapping.Root, err)
+		}
+	}
+	for field, path := range mapping.Fields {
+		_, err := xpath.Compile(path)
+		if err != nil {
+			return fmt.Errorf("%w: field %s %s: %w", ErrMappingInvalid, field, path, err)
+		}
+	}
+	return nil
+}
+
+// 校验JSONPath表达式
+func (mapping *ResponseMapping) ValidateJSONPath() error {
+	if mapping.Root != "" {
+		_, err := jsonpath.New(mapping.Root)
+		if err != nil {
+			return fmt.Errorf("%w: root %s: %w", ErrMappingInvalid, mapping.Root, err)
+		}
+	}
+	for field, path := range mapping.Fields {
+		_, err := jsonpath.New(path)
+		if err != nil {
+			return fmt.Errorf("%w: field %s %s: %w", ErrMappingInvalid, field, path, err)
+		}
+	}
+	return nil
+}
+
+// 映射JSON响应，返回平铺键值对列表
+func (mapping *ResponseMapping) MapJSON(body []byte) ([]map[string]interface{}, error) {
+	var data interface{}
+	err := json.Unmarshal(body, &data)
+	if err != nil {
+		return nil, err
+	}
+	root := data
+	if mapping.Root != "" {
+		root, err = jsonpath.Get(mapping.Root, data)
+		if err != nil {
+			return nil, fmt.Errorf("get mapping root %s failed: %w", mapping.Root, err)
+		}
+	}
+	var items []interface{}
+	switch v := root.(type) {
+	case []interface{}:
+		items = v
+	case nil:
+		items = []interface{}{}
+	default:
+		items = []interface{}{v}
+	}
+	paths := make(map[string]gval.Evaluable, len(mapping.Fields))
+	for field, path := range mapping.Fields {
+		paths[field], err = jsonpath.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s %s: %w", ErrMappingInvalid, field, path, err)
+		}
+	}
+	list := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		flat := map[string]interface{}{}
+		for field, eval := range paths {
+			// 路径不存在时字段为空
+			val, err := eval(context.Background(), item)
+			if err != nil {
+				continue
+			}
+			flat[field] = val
+		}
+		list[i] = flat
+	}
+	return list, nil
+}
+
+// 映射XML响应，返回平铺键值对列表，字段表达式可为节点（取文本）或count()等函数
+func (mapping *ResponseMapping) MapXML(body []byte) ([]map[string]interface{}, error) {
+	doc, err := xmlquery.Parse(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	items := []*xmlquery.Node{doc}
+	if mapping.Root != "" {
+		items, err = xmlquery.QueryAll(doc, mapping.Root)
+		if err != nil {
+			return nil, fmt.Errorf("get mapping root %s failed: %w", mapping.Root, err)
+		}
+	}
+	paths := make(map[string]*xpath.Expr, len(mapping.Fields))
+	for field, path := range mapping.Fields {
+		paths[field], err = xpath.Compile(path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: field %s %s: %w", ErrMappingInvalid, field, path, err)
+		}
+	}
+	list := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		flat := map[string]interface{}{}
+		for field, expr := range paths {
+			switch val := expr.Evaluate(xmlquery.CreateXPathNavigator(item)).(type) {
+			case *xpath.NodeIterator:
+				// 节点取第一个匹配的文本，不存在时字段为空
+				if val.MoveNext() {
+					flat[field] = val.Current().Value()
+				}
+			default:
+				flat[field] = val
+			}
+		}
+		list[i] = flat
+	}
+	return list, nil
+}
@@ -0,0 +1,102 @@
+package modules
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMapXML(t *testing.T) {
+	body := []byte(`<?xml version="1.0" encoding="utf-8"?>
+<soap:Envelope xmlns:soap="http://schemas.xmlsoap.org/soap/envelope/">
+  <soap:Body>
+    <GetStockResponse xmlns="http://example.com/">
+      <Item><Site>MA-103</Site><Expire1Day>3</Expire1Day><Bin>A1</Bin><Bin>A2</Bin></Item>
+      <Item><Site>MA-104</Site><Expire1Day>0</Expire1Day></Item>
+    </GetStockResponse>
+  </soap:Body>
+</soap:Envelope>`)
+	mapping := &ResponseMapping{
+		Root: "//*[local-name()='Item']",
+		Fields: map[string]string{
+			"Expire1Day":  "*[local-name()='Expire1Day']",
+			"Expire1Week": "count(*[local-name()='Bin'])",
+			"Extend.Site": "*[local-name()='Site']",
+			"Extend.Lot":  "*[local-name()='Lot']",
+		},
+	}
+	list, err := mapping.MapXML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("unexpected items %v", list)
+	}
+	first := list[0]
+	if first["Expire1Day"] != "3" || first["Expire1Week"] != float64(2) || first["Extend.Site"] != "MA-103" {
+		t.Errorf("unexpected first item %v", first)
+	}
+	// 节点不存在时字段为空
+	if _, ok := first["Extend.Lot"]; ok {
+		t.Errorf("missing node is mapped %v", first)
+	}
+	if list[1]["Extend.Site"] != "MA-104" || list[1]["Expire1Week"] != float64(0) {
+		t.Errorf("unexpected second item %v", list[1])
+	}
+
+	// 未配置根路径时使用整个文档
+	list, err = DefaultXMLMapping.MapXML(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0]["Expire1Day"] != "3" {
+		t.Errorf("unexpected default mapping %v", list)
+	}
+
+	_, err = mapping.MapXML([]byte("<Item>"))
+	if err == nil {
+		t.Error("invalid xml is mapped")
+	}
+}
+
+func TestValidateXPath(t *testing.T) {
+	valid := &ResponseMapping{
+		Root:   "//*[local-name()='Item']",
+		Fields: map[string]string{"Expire1Day": "count(Bin)"},
+	}
+	err := valid.ValidateXPath()
+	if err != nil {
+		t.Error(err)
+	}
+	for _, mapping := range []*ResponseMapping{
+		{Root: "//*[", Fields: map[string]string{"Expire1Day": "Expire1Day"}},
+		{Fields: map[string]string{"Expire1Day": "count("}},
+	} {
+		err := mapping.ValidateXPath()
+		if !errors.Is(err, ErrMappingInvalid) {
+			t.Errorf("unexpected error %v for %v", err, mapping)
+		}
+	}
+}
+
+func TestValidateMappingByType(t *testing.T) {
+	xmlMapping := &ResponseMapping{Fields: map[string]string{"Expire1Day": "//*[local-name()='Expire1Day']"}}
+	jsonMapping := &ResponseMapping{Root: "$.data.items", Fields: map[string]string{"Expire1Day": "$.expire"}}
+	for _, c := range []struct {
+		Mapping *ResponseMapping
+		Type    string
+		Valid   bool
+	}{
+		{xmlMapping, DatasourceTypeSOAP, true},
+		{xmlMapping, DatasourceTypeAPI, false},
+		{jsonMapping, DatasourceTypeAPI, true},
+		{jsonMapping, DatasourceTypeSOAP, false},
+		// 其他类型不使用映射，不做校验
+		{xmlMapping, DatasourceTypeFilesystem, true},
+		{xmlMapping, DatasourceTypeMySQL, true},
+	} {
+		err := c.Mapping.Validate(c.Type)
+		if (err == nil) != c.Valid {
+			t.Errorf("unexpected error %v for %s %v", err, c.Type, c.Mapping.Fields)
+		}
+	}
+}
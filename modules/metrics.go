@@ -0,0 +1,115 @@
+package modules
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Prometheus指标
+var (
+	metricBucketCount = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "watcher",
+		Name:      "bucket_count",
+		Help:      "Expired data count of the last successful run by watcher, datasource and bucket.",
+	}, []string{"app", "datasource", "bucket"})
+	metricRunDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "watcher",
+		Name:      "run_duration_seconds",
+		Help:      "Duration of watcher runs.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"app"})
+	metricDatasourceDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "watcher",
+		Name:      "datasource_duration_seconds",
+		Help:      "Duration of getting expired data from a datasource.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"app", "datasource"})
+	metricRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "watcher",
+		Name:      "runs_total",
+		Help:      "Number of watcher runs.",
+	}, []string{"app", "trigger"})
+	metricFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "watcher",
+		Name:      "failures_total",
+		Help:      "Number of failed datasource queries by error type.",
+	}, []string{"app", "datasource", "type"})
+	metricScheduled = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "watcher",
+		Name:      "scheduled",
+		Help:      "Whether the watcher is scheduled (1) or not (0).",
+	}, []string{"app"})
+	metricSchedulerStatus = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "watcher",
+		Name:      "scheduler_status",
+		Help:      "Scheduler status, 1 for started and 0 for stopped.",
+	})
+	metricElasticFailures = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "watcher",
+		Name:      "elastic_index_failures_total",
+		Help:      "Number of documents failed to index into Elasticsearch.",
+	})
+	metricSinkFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "watcher",
+		Name:      "sink_failures_total",
+		Help:      "Number of failed writes to result sinks.",
+	}, []string{"sink"})
+	metricElasticUp = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "watcher",
+		Name:      "elastic_up",
+		Help:      "Whether Elasticsearch is reachable (1) or not (0).",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(
+		metricBucketCount,
+		metricRunDuration,
+		metricDatasourceDuration,
+		metricRuns,
+		metricFailures,
+		metricScheduled,
+		metricSchedulerStatus,
+		metricElasticFailures,
+		metricElasticUp,
+		metricSinkFailures,
+	)
+}
+
+// 记录数据源运行指标，成功时以本次结果替换分段数量
+func observeDatasource(watcher *WatcherConfig, datasource string, source *WatcherRunSource, datas *[]ExpiredData, err error) {
+	metricDatasourceDuration.WithLabelValues(watcher.App, datasource).Observe(float64(source.Duration) / 1000)
+	if err != nil {
+		metricFailures.WithLabelValues(watcher.App, datasource, classifyDatasourceError(err)).Inc()
+		return
+	}
+	counts := map[string]int{}
+	for _, bucket := range watcher.GetBuckets() {
+		counts[bucket.Name] = 0
+	}
+	for _, data := range *datas {
+		for name, count := range data.Buckets {
+			counts[name] += count
+		}
+	}
+	metricBucketCount.DeletePartialMatch(prometheus.Labels{"app": watcher.App, "datasource": datasource})
+	for name, count := range counts {
+		metricBucketCount.WithLabelValues(watcher.App, datasource, name).Set(float64(count))
+	}
+}
+
+// 记录监控运行指标
+func observeRun(run *WatcherRun) {
+	metricRuns.WithLabelValues(run.App, run.Trigger).Inc()
+	metricRunDuration.WithLabelValues(run.App).Observe(float64(run.Duration) / 1000)
+}
+
+// 移除监控指标
+func RemoveWatcherMetrics(app string) {
+	labels := prometheus.Labels{"app": app}
+	metricBucketCount.DeletePartialMatch(labels)
+	metricRunDuration.DeletePartialMatch(labels)
+	metricDatasourceDuration.DeletePartialMatch(labels)
+	metricRuns.DeletePartialMatch(labels)
+	metricFailures.DeletePartialMatch(labels)
+	metricScheduled.DeletePartialMatch(labels)
+}
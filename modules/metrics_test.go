@@ -0,0 +1,144 @@
+package modules
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// 收集指定监控的指标，指标为全局注册，按app标签过滤避免受其他测试影响
+func collectAppMetrics(t *testing.T, collector prometheus.Collector, app string) []*dto.Metric {
+	t.Helper()
+	ch := make(chan prometheus.Metric)
+	go func() {
+		collector.Collect(ch)
+		close(ch)
+	}()
+	metrics := make([]*dto.Metric, 0)
+	for metric := range ch {
+		m := &dto.Metric{}
+		err := metric.Write(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, label := range m.GetLabel() {
+			if label.GetName() == "app" && label.GetValue() == app {
+				metrics = append(metrics, m)
+			}
+		}
+	}
+	return metrics
+}
+
+// 获取标签值
+func metricLabel(m *dto.Metric, name string) string {
+	for _, label := range m.GetLabel() {
+		if label.GetName() == name {
+			return label.GetValue()
+		}
+	}
+	return ""
+}
+
+func TestObserveDatasource(t *testing.T) {
+	watcher := &WatcherConfig{App: "metrics-datasource", Buckets: []Bucket{{Name: "Stale", Threshold: "1d"}, {Name: "Old", Threshold: "7d"}}}
+	source := &WatcherRunSource{Duration: 1500}
+	observeDatasource(watcher, "MA-103", source, &[]ExpiredData{
+		{Buckets: map[string]int{"Stale": 2}},
+		{Buckets: map[string]int{"Stale": 1, "Old": 4}},
+	}, nil)
+	if val := testutil.ToFloat64(metricBucketCount.WithLabelValues(watcher.App, "MA-103", "Stale")); val != 3 {
+		t.Errorf("unexpected Stale count %v", val)
+	}
+	if val := testutil.ToFloat64(metricBucketCount.WithLabelValues(watcher.App, "MA-103", "Old")); val != 4 {
+		t.Errorf("unexpected Old count %v", val)
+	}
+
+	// 分段变化后以本次结果替换，不保留旧分段
+	watcher.Buckets = []Bucket{{Name: "Aged", Threshold: "3d"}}
+	observeDatasource(watcher, "MA-103", source, &[]ExpiredData{}, nil)
+	gauges := collectAppMetrics(t, metricBucketCount, watcher.App)
+	if len(gauges) != 1 || metricLabel(gauges[0], "bucket") != "Aged" || gauges[0].GetGauge().GetValue() != 0 {
+		t.Fatalf("bucket gauges are not replaced %v", gauges)
+	}
+	observeDatasource(watcher, "MA-103", source, &[]ExpiredData{{Buckets: map[string]int{"Aged": 5}}}, nil)
+
+	// 失败时按错误类型计数，保留上次成功结果
+	for _, err := range []error{
+		&datasourceHTTPError{StatusCode: 503},
+		&datasourceConfigError{errors.New("invalid body template")},
+		&datasourceConfigError{errors.New("invalid headers")},
+		errors.New("dial tcp 127.0.0.1:1433: connection refused"),
+	} {
+		observeDatasource(watcher, "MA-103", source, nil, err)
+	}
+	for errType, expected := range map[string]float64{
+		DatasourceErrorHTTP:    1,
+		DatasourceErrorConfig:  2,
+		DatasourceErrorNetwork: 1,
+	} {
+		if val := testutil.ToFloat64(metricFailures.WithLabelValues(watcher.App, "MA-103", errType)); val != expected {
+			t.Errorf("unexpected %s failures %v", errType, val)
+		}
+	}
+	if val := testutil.ToFloat64(metricBucketCount.WithLabelValues(watcher.App, "MA-103", "Aged")); val != 5 {
+		t.Errorf("bucket gauge is changed by failures %v", val)
+	}
+	durations := collectAppMetrics(t, metricDatasourceDuration, watcher.App)
+	if len(durations) != 1 || durations[0].GetHistogram().GetSampleCount() != 7 || durations[0].GetHistogram().GetSampleSum() != 7*1.5 {
+		t.Errorf("unexpected datasource durations %v", durations)
+	}
+}
+
+func TestObserveRun(t *testing.T) {
+	app := "metrics-run"
+	for _, trigger := range []string{RunTriggerCron, RunTriggerCron, RunTriggerManual} {
+		observeRun(&WatcherRun{App: app, Trigger: trigger, Duration: 2000})
+	}
+	if val := testutil.ToFloat64(metricRuns.WithLabelValues(app, RunTriggerCron)); val != 2 {
+		t.Errorf("unexpected cron runs %v", val)
+	}
+	if val := testutil.ToFloat64(metricRuns.WithLabelValues(app, RunTriggerManual)); val != 1 {
+		t.Errorf("unexpected manual runs %v", val)
+	}
+	durations := collectAppMetrics(t, metricRunDuration, app)
+	if len(durations) != 1 {
+		t.Fatalf("unexpected run durations %v", durations)
+	}
+	histogram := durations[0].GetHistogram()
+	if histogram.GetSampleCount() != 3 || histogram.GetSampleSum() != 6 {
+		t.Errorf("unexpected run duration count %d sum %v", histogram.GetSampleCount(), histogram.GetSampleSum())
+	}
+}
+
+func TestRemoveWatcherMetrics(t *testing.T) {
+	removed := &WatcherConfig{App: "metrics-removed"}
+	kept := &WatcherConfig{App: "metrics-kept"}
+	for _, watcher := range []*WatcherConfig{removed, kept} {
+		source := &WatcherRunSource{Duration: 100}
+		observeDatasource(watcher, "MA-103", source, &[]ExpiredData{{Buckets: map[string]int{"Expire1Day": 1}}}, nil)
+		observeDatasource(watcher, "MA-104", source, nil, errors.New("connection refused"))
+		observeRun(&WatcherRun{App: watcher.App, Trigger: RunTriggerCron, Duration: 100})
+		metricScheduled.WithLabelValues(watcher.App).Set(1)
+	}
+	collectors := map[string]prometheus.Collector{
+		"bucket_count":                metricBucketCount,
+		"run_duration_seconds":        metricRunDuration,
+		"datasource_duration_seconds": metricDatasourceDuration,
+		"runs_total":                  metricRuns,
+		"failures_total":              metricFailures,
+		"scheduled":                   metricScheduled,
+	}
+	RemoveWatcherMetrics(removed.App)
+	for name, collector := range collectors {
+		if metrics := collectAppMetrics(t, collector, removed.App); len(metrics) != 0 {
+			t.Errorf("%s of removed watcher is not deleted %v", name, metrics)
+		}
+		if metrics := collectAppMetrics(t, collector, kept.App); len(metrics) == 0 {
+			t.Errorf("%s of other watcher is deleted", name)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package modules
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// MQTT结果默认主题模板
+const MQTTDefaultTopic = "datawatcher/{System}/{App}/{Datasource}"
+
+// MQTT告警默认主题模板
+const MQTTDefaultAlertTopic = "datawatcher/{System}/{App}/alerts/{Rule}"
+
+var ErrMQTTNotConnected = errors.New("mqtt is not connected")
+
+// MQTT重连最大间隔
+const MQTTMaxReconnectInterval = time.Minute
+
+// 接收告警状态变化的输出
+type AlertSink interface {
+	WriteAlert(event AlertEvent) error
+}
+
+// 校验MQTT输出配置
+func (conf *SinkConfig) validateMQTT() error {
+	u, err := url.Parse(conf.Url)
+	if err != nil || u.Host == "" {
+		return fmt.Errorf("%w: sink %s has invalid url %s", ErrSinkNotSupport, conf.Name, conf.Url)
+	}
+	switch u.Scheme {
+	case "tcp", "mqtt", "ssl", "tls", "mqtts", "ws", "wss":
+	default:
+		return fmt.Errorf("%w: sink %s has invalid scheme %s", ErrSinkNotSupport, conf.Name, u.Scheme)
+	}
+	if conf.QoS > 2 {
+		return fmt.Errorf("%w: sink %s has invalid qos %d", ErrSinkNotSupport, conf.Name, conf.QoS)
+	}
+	for _, topic := range []string{conf.Topic, conf.AlertTopic} {
+		if strings.ContainsAny(topic, "+#") {
+			return fmt.Errorf("%w: topic %s contains wildcard", ErrSinkNotSupport, topic)
+		}
+	}
+	_, err = conf.getTLSConfig()
+	if err != nil {
+		return fmt.Errorf("%w: sink %s %s", ErrSinkNotSupport, conf.Name, err.Error())
+	}
+	return nil
+}
+
+// 生成TLS配置，未配置证书及跳过校验时返回nil，ssl/tls地址使用默认配置
+func (conf *SinkConfig) getTLSConfig() (*tls.Config, error) {
+	if conf.CACert == "" && conf.Cert == "" && !conf.SkipVerify {
+		return nil, nil
+	}
+	config := &tls.Config{
+		InsecureSkipVerify: conf.SkipVerify,
+	}
+	if conf.CACert != "" {
+		pem, err := os.ReadFile(conf.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("invalid ca cert " + conf.CACert)
+		}
+		config.RootCAs = pool
+	}
+	if conf.Cert != "" {
+		cert, err := tls.LoadX509KeyPair(conf.Cert, conf.Key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// 发布到MQTT，每条结果及告警状态变化各发布一条json消息
+type MQTTSink struct {
+	Config *SinkConfig
+	Client mqtt.Client
+}
+
+// 创建MQTT输出，后台连接及断线重连，不阻塞启动
+func NewMQTTSink(conf *SinkConfig) (*MQTTSink, error) {
+	tlsConfig, err := conf.getTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	u, _ := url.Parse(conf.Url)
+	switch u.Scheme {
+	case "mqtt":
+		u.Scheme = "tcp"
+	case "mqtts":
+		u.Scheme = "ssl"
+	}
+	clientID := conf.ClientID
+	if clientID == "" {
+		hostname, _ := os.Hostname()
+		clientID = "datawatcher-" + hostname + "-" + conf.Name
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(u.String()).
+		SetClientID(clientID).
+		SetUsername(conf.Username).
+		SetPassword(conf.Password).
+		SetConnectTimeout(conf.getTimeout()).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetMaxReconnectInterval(MQTTMaxReconnectInterval).
+		SetOnConnectHandler(func(mqtt.Client) {
+			log.Printf("MQTT sink %s connected", conf.Name)
+		}).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT sink %s connection lost: %v", conf.Name, err)
+		})
+	if tlsConfig != nil {
+		opts.SetTLSConfig(tlsConfig)
+	}
+	client := mqtt.NewClient(opts)
+	client.Connect()
+	return &MQTTSink{
+		Config: conf,
+		Client: client,
+	}, nil
+}
+
+var mqttTopicEscaper = strings.NewReplacer("/", "_", "+", "_", "#", "_")
+
+// 渲染主题模板，变量中的“/”“+”“#”替换为“_”，空值替换为“_”
+func MQTTTopic(template string, vars map[string]string) string {
+	pairs := make([]string, 0, len(vars)*2)
+	for key, val := range vars {
+		val = mqttTopicEscaper.Replace(val)
+		if val == "" {
+			val = "_"
+		}
+		pairs = append(pairs, "{"+key+"}", val)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+func watcherTopicVars(watcher *WatcherConfig) map[string]string {
+	return map[string]string{
+		"App":       watcher.App,
+		"Module":    watcher.Module,
+		"System":    watcher.System,
+		"Provider":  watcher.Provider,
+		"Requester": watcher.Requester,
+	}
+}
+
+func (sink *MQTTSink) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	template := sink.Config.Topic
+	if template == "" {
+		template = MQTTDefaultTopic
+	}
+	// 未连接时paho会缓存消息，但clean session连接成功后即丢弃，直接返回错误
+	if !sink.Client.IsConnectionOpen() {
+		return ErrMQTTNotConnected
+	}
+	vars := watcherTopicVars(watcher)
+	tokens := make([]mqtt.Token, 0, len(datas))
+	for _, data := range datas {
+		payload, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		vars["Datasource"] = data.Datasource
+		tokens = append(tokens, sink.Client.Publish(MQTTTopic(template, vars), sink.Config.QoS, sink.Config.Retain, payload))
+	}
+	return sink.wait(tokens)
+}
+
+// 发布告警状态变化
+func (sink *MQTTSink) WriteAlert(event AlertEvent) error {
+	template := sink.Config.AlertTopic
+	if template == "" {
+		template = MQTTDefaultAlertTopic
+	}
+	if !sink.Client.IsConnectionOpen() {
+		return ErrMQTTNotConnected
+	}
+	vars := watcherTopicVars(event.Watcher)
+	vars["Datasource"] = event.Alert.Datasource
+	vars["Rule"] = event.Alert.Rule
+	vars["Severity"] = event.Alert.Severity
+	vars["State"] = event.Alert.State
+	payload, err := json.Marshal(event.Alert)
+	if err != nil {
+		return err
+	}
+	return sink.wait([]mqtt.Token{sink.Client.Publish(MQTTTopic(template, vars), sink.Config.QoS, sink.Config.Retain, payload)})
+}
+
+// 等待发布完成，QoS 0在写入连接后即完成
+func (sink *MQTTSink) wait(tokens []mqtt.Token) error {
+	deadline := time.Now().Add(sink.Config.getTimeout())
+	for _, token := range tokens {
+		if !token.WaitTimeout(time.Until(deadline)) {
+			return errors.New("publish timeout")
+		}
+		if token.Error() != nil {
+			return token.Error()
+		}
+	}
+	return nil
+}
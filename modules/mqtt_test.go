@@ -0,0 +1,223 @@
+package modules
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/mochi-mqtt/server/v2/packets"
+)
+
+func TestMQTTTopic(t *testing.T) {
+	topic := MQTTTopic(MQTTDefaultTopic, map[string]string{
+		"App":        "Order/Sync",
+		"System":     "",
+		"Datasource": "NB+146#",
+	})
+	if topic != "datawatcher/_/Order_Sync/NB_146_" {
+		t.Errorf("unexpected topic %s", topic)
+	}
+}
+
+func TestValidateMQTT(t *testing.T) {
+	dir := t.TempDir()
+	invalidCA := filepath.Join(dir, "ca.pem")
+	err := os.WriteFile(invalidCA, []byte("not a certificate"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range []struct {
+		Name string
+		Conf SinkConfig
+	}{
+		{"wildcard topic", SinkConfig{Url: "tcp://127.0.0.1:1883", Topic: "datawatcher/+/{App}"}},
+		{"wildcard alert topic", SinkConfig{Url: "tcp://127.0.0.1:1883", AlertTopic: "datawatcher/{App}/#"}},
+		{"qos", SinkConfig{Url: "tcp://127.0.0.1:1883", QoS: 3}},
+		{"scheme", SinkConfig{Url: "http://127.0.0.1:1883"}},
+		{"no host", SinkConfig{Url: "127.0.0.1:1883"}},
+		{"missing ca file", SinkConfig{Url: "ssl://127.0.0.1:8883", CACert: filepath.Join(dir, "missing.pem")}},
+		{"invalid ca file", SinkConfig{Url: "ssl://127.0.0.1:8883", CACert: invalidCA}},
+	} {
+		c.Conf.Name = "mqtt"
+		c.Conf.Type = SinkTypeMQTT
+		err := c.Conf.Validate()
+		if !errors.Is(err, ErrSinkNotSupport) {
+			t.Errorf("%s: unexpected error %v", c.Name, err)
+		}
+	}
+	valid := &SinkConfig{Name: "mqtt", Type: SinkTypeMQTT, Url: "mqtts://127.0.0.1:8883", QoS: 2, SkipVerify: true}
+	err = valid.Validate()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+// 启动进程内broker，返回broker及tcp地址
+func newMQTTBroker(t *testing.T) (*mochi.Server, string) {
+	t.Helper()
+	server := mochi.New(&mochi.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	err := server.AddHook(new(auth.AllowHook), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "tcp", Address: "127.0.0.1:0"})
+	err = server.AddListener(tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = server.Serve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		server.Close()
+	})
+	return server, "tcp://" + tcp.Address()
+}
+
+// 创建并等待连接MQTT输出
+func newTestMQTTSink(t *testing.T, conf *SinkConfig) *MQTTSink {
+	t.Helper()
+	err := conf.Validate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink, err := NewMQTTSink(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		sink.Client.Disconnect(100)
+	})
+	for i := 0; i < 50 && !sink.Client.IsConnectionOpen(); i++ {
+		time.Sleep(100 * time.Millisecond)
+	}
+	if !sink.Client.IsConnectionOpen() {
+		t.Fatal("mqtt sink is not connected")
+	}
+	return sink
+}
+
+// 订阅记录，按主题保存最近一条消息
+type mqttMessages struct {
+	Mutex    sync.Mutex
+	Messages map[string]packets.Packet
+}
+
+func (messages *mqttMessages) add(pk packets.Packet) {
+	messages.Mutex.Lock()
+	defer messages.Mutex.Unlock()
+	messages.Messages[pk.TopicName] = pk
+}
+
+// 等待主题收到消息
+func (messages *mqttMessages) wait(t *testing.T, topic string) packets.Packet {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		messages.Mutex.Lock()
+		pk, ok := messages.Messages[topic]
+		messages.Mutex.Unlock()
+		if ok {
+			return pk
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("message of %s is not received", topic)
+	return packets.Packet{}
+}
+
+func TestMQTTSinkPublish(t *testing.T) {
+	broker, url := newMQTTBroker(t)
+	sink := newTestMQTTSink(t, &SinkConfig{
+		Name:       "test",
+		Type:       SinkTypeMQTT,
+		Url:        url,
+		ClientID:   "datawatcher-test",
+		Topic:      "datawatcher-test/{System}/{App}/{Datasource}",
+		AlertTopic: "datawatcher-test/{App}/alerts/{Severity}/{Rule}/{State}",
+		QoS:        1,
+		Retain:     true,
+	})
+	watcher := &WatcherConfig{App: "order/sync", Module: "MES"}
+	err := sink.Write(watcher, []ExpiredData{
+		{Datasource: "MA-103", Buckets: map[string]int{"Expire1Day": 5}},
+		{Datasource: "NB+146#", Buckets: map[string]int{"Expire1Day": 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 保留消息在订阅后立即收到
+	messages := &mqttMessages{Messages: map[string]packets.Packet{}}
+	err = broker.Subscribe("datawatcher-test/#", 1, func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		messages.add(pk)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk := messages.wait(t, "datawatcher-test/_/order_sync/MA-103")
+	var data ExpiredData
+	err = json.Unmarshal(pk.Payload, &data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data.Datasource != "MA-103" || data.Buckets["Expire1Day"] != 5 || !pk.FixedHeader.Retain {
+		t.Errorf("unexpected message %s retain %v", pk.Payload, pk.FixedHeader.Retain)
+	}
+	messages.wait(t, "datawatcher-test/_/order_sync/NB_146_")
+
+	err = sink.WriteAlert(AlertEvent{
+		Watcher: watcher,
+		Alert:   Alert{App: watcher.App, Rule: "backlog", Severity: AlertSeverityWarning, Datasource: "MA-103", State: AlertStateFiring, Value: 5},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	alertTopic := "datawatcher-test/order_sync/alerts/" + AlertSeverityWarning + "/backlog/" + AlertStateFiring
+	pk = messages.wait(t, alertTopic)
+	var alert Alert
+	err = json.Unmarshal(pk.Payload, &alert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alert.Rule != "backlog" || alert.State != AlertStateFiring || alert.Value != 5 {
+		t.Errorf("unexpected alert %s", pk.Payload)
+	}
+	if retained := broker.Topics.Messages(alertTopic); len(retained) != 1 {
+		t.Errorf("alert is not retained %v", retained)
+	}
+}
+
+func TestMQTTSinkNotRetained(t *testing.T) {
+	broker, url := newMQTTBroker(t)
+	sink := newTestMQTTSink(t, &SinkConfig{Name: "test", Type: SinkTypeMQTT, Url: url, ClientID: "datawatcher-test"})
+	messages := &mqttMessages{Messages: map[string]packets.Packet{}}
+	err := broker.Subscribe("datawatcher/#", 1, func(_ *mochi.Client, _ packets.Subscription, pk packets.Packet) {
+		messages.add(pk)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sink.Write(&WatcherConfig{App: "order", System: "WMS"}, []ExpiredData{{Datasource: "MA-103"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 默认主题模板
+	messages.wait(t, "datawatcher/WMS/order/MA-103")
+	if retained := broker.Topics.Messages("datawatcher/#"); len(retained) != 0 {
+		t.Errorf("unexpected retained messages %v", retained)
+	}
+}
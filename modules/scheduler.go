@@ -1,6 +1,8 @@
 package modules
 
 import (
+	"strings"
+
 	"github.com/robfig/cron/v3"
 )
 
@@ -9,6 +11,34 @@ var (
 	SchedulerStatusStart int8 = 1
 )
 
+// Cron表达式解析器，支持6段（秒 分 时 日 月 周）、5段（分 时 日 月 周）及@daily、@every 5m等描述符，
+// 旧版3段（秒 分 时）表达式视为每天执行
+var CronParser = cronParser{
+	parser: cron.NewParser(cron.SecondOptional | cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor),
+}
+
+type cronParser struct {
+	parser cron.Parser
+}
+
+func (p cronParser) Parse(spec string) (cron.Schedule, error) {
+	return p.parser.Parse(NormalizeCron(spec))
+}
+
+// 将旧版3段表达式补全为6段，其他表达式原样返回，时区前缀（TZ=/CRON_TZ=）保留
+func NormalizeCron(spec string) string {
+	fields := strings.Fields(spec)
+	prefix := ""
+	if len(fields) > 0 && (strings.HasPrefix(fields[0], "TZ=") || strings.HasPrefix(fields[0], "CRON_TZ=")) {
+		prefix = fields[0] + " "
+		fields = fields[1:]
+	}
+	if len(fields) != 3 {
+		return spec
+	}
+	return prefix + strings.Join(fields, " ") + " * * *"
+}
+
 // 调度器
 type Scheduler struct {
 	Cron   *cron.Cron // Cron调度器
@@ -18,13 +48,11 @@ type Scheduler struct {
 func (scheduler *Scheduler) Init() {
 	if scheduler.Cron == nil {
 		scheduler.Cron = cron.New(
-			cron.WithParser(
-				cron.NewParser(cron.Second | cron.Minute | cron.Hour),
-			),
+			cron.WithParser(CronParser),
 		)
 	}
 }
-func (scheduler *Scheduler) Start(watchers *[]*WatcherConfig, datasources *[]*Datasource, elastic *Elastic) {
+func (scheduler *Scheduler) Start(watchers *[]*WatcherConfig, datasources *[]*Datasource, sinks *SinkManager, alerts *AlertManager, history *History) {
 	if scheduler.Status == SchedulerStatusStop {
 		// fmt.Printf("GOMAXPROCS=%d\n", runtime.GOMAXPROCS(0))
 		scheduler.Status = SchedulerStatusStart
@@ -34,12 +62,13 @@ func (scheduler *Scheduler) Start(watchers *[]*WatcherConfig, datasources *[]*Da
 				// watcher.Stop()
 				continue
 			}
-			_, err := watcher.Start(scheduler.Cron, datasources, elastic)
+			_, err := watcher.Start(scheduler.Cron, datasources, sinks, alerts, history)
 			if err != nil {
 				continue
 			}
 		}
 		scheduler.Cron.Start()
+		metricSchedulerStatus.Set(1)
 	}
 }
 
@@ -49,4 +78,5 @@ func (scheduler *Scheduler) Stop(watchers *[]*WatcherConfig) {
 		watcher.Stop(scheduler.Cron)
 	}
 	scheduler.Status = SchedulerStatusStop
+	metricSchedulerStatus.Set(0)
 }
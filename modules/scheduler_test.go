@@ -0,0 +1,49 @@
+package modules
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronParser(t *testing.T) {
+	// 2024-01-05为周五
+	now := time.Date(2024, 1, 5, 9, 30, 0, 0, time.Local)
+	tests := map[string]time.Time{
+		"0 0/30 *":          time.Date(2024, 1, 5, 10, 0, 0, 0, time.Local),
+		"0 0 8":             time.Date(2024, 1, 6, 8, 0, 0, 0, time.Local),
+		"0 0 8 * * MON-FRI": time.Date(2024, 1, 8, 8, 0, 0, 0, time.Local),
+		"0 0 0 1 * *":       time.Date(2024, 2, 1, 0, 0, 0, 0, time.Local),
+		"0 8 * * 1-5":       time.Date(2024, 1, 8, 8, 0, 0, 0, time.Local),
+		"@daily":            time.Date(2024, 1, 6, 0, 0, 0, 0, time.Local),
+		"@every 5m":         now.Add(5 * time.Minute),
+	}
+	for spec, expected := range tests {
+		schedule, err := CronParser.Parse(spec)
+		if err != nil {
+			t.Errorf("parse %s failed: %v", spec, err)
+			continue
+		}
+		if next := schedule.Next(now); !next.Equal(expected) {
+			t.Errorf("next of %s is %s, expected %s", spec, next, expected)
+		}
+	}
+	for _, spec := range []string{"0 0", "0 0 8 *", "0 0 25"} {
+		if _, err := CronParser.Parse(spec); err == nil {
+			t.Errorf("expected parse %s failed", spec)
+		}
+	}
+}
+
+func TestNormalizeCron(t *testing.T) {
+	tests := map[string]string{
+		"0 0/30 *":                    "0 0/30 * * * *",
+		"CRON_TZ=Asia/Shanghai 0 0 8": "CRON_TZ=Asia/Shanghai 0 0 8 * * *",
+		"0 0 8 * * MON-FRI":           "0 0 8 * * MON-FRI",
+		"@daily":                      "@daily",
+	}
+	for spec, expected := range tests {
+		if normalized := NormalizeCron(spec); normalized != expected {
+			t.Errorf("normalize %s to %s, expected %s", spec, normalized, expected)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package modules
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSilenceNotFound = errors.New("silence not found")
+	ErrSilenceInvalid  = errors.New("silence is invalid")
+)
+
+// 静默，匹配的监控告警不发送通知，数据照常采集
+// 配置From/To时为周期性维护窗口（如每周日02:00-04:00），StartsAt/EndsAt为可选的生效区间；否则为一次性静默，StartsAt/EndsAt必填
+type Silence struct {
+	ID         string    `yaml:"ID"`                   // 编号
+	App        string    `yaml:"App,omitempty"`        // 应用名称
+	Tags       []string  `yaml:"Tags,omitempty"`       // 标签，监控标签匹配任一时匹配
+	System     string    `yaml:"System,omitempty"`     // 系统
+	Provider   string    `yaml:"Provider,omitempty"`   // 提供方
+	Datasource string    `yaml:"Datasource,omitempty"` // 数据源编号
+	StartsAt   time.Time `yaml:"StartsAt,omitempty"`   // 开始时间
+	EndsAt     time.Time `yaml:"EndsAt,omitempty"`     // 结束时间
+	Weekdays   []string  `yaml:"Weekdays,omitempty"`   // 维护窗口星期，如Sunday、Sun，为空时每天
+	From       string    `yaml:"From,omitempty"`       // 维护窗口开始时刻，如02:00
+	To         string    `yaml:"To,omitempty"`         // 维护窗口结束时刻，如04:00，早于开始时刻时跨天
+	Comment    string    `yaml:"Comment,omitempty"`    // 备注
+	CreatedAt  time.Time `yaml:"CreatedAt"`            // 创建时间
+}
+
+// 生成静默编号
+func NewSilenceID() string {
+	buf := make([]byte, 8)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// 是否周期性维护窗口
+func (silence *Silence) IsRecurring() bool {
+	return silence.From != "" || silence.To != ""
+}
+
+// 校验静默配置
+func (silence *Silence) Validate() error {
+	if silence.App == "" && len(silence.Tags) == 0 && silence.System == "" && silence.Provider == "" && silence.Datasource == "" {
+		return fmt.Errorf("%w: silence has no matcher", ErrSilenceInvalid)
+	}
+	if !silence.StartsAt.IsZero() && !silence.EndsAt.IsZero() && !silence.EndsAt.After(silence.StartsAt) {
+		return fmt.Errorf("%w: ends before starts", ErrSilenceInvalid)
+	}
+	if !silence.IsRecurring() {
+		if silence.StartsAt.IsZero() || silence.EndsAt.IsZero() {
+			return fmt.Errorf("%w: silence has no start or end", ErrSilenceInvalid)
+		}
+		if len(silence.Weekdays) > 0 {
+			return fmt.Errorf("%w: weekdays require from and to", ErrSilenceInvalid)
+		}
+		return nil
+	}
+	_, err := parseClock(silence.From)
+	if err != nil {
+		return err
+	}
+	_, err = parseClock(silence.To)
+	if err != nil {
+		return err
+	}
+	for _, weekday := range silence.Weekdays {
+		_, err := parseWeekday(weekday)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 解析时刻，返回距零点时长
+func parseClock(clock string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(clock))
+	if err != nil {
+		return 0, fmt.Errorf("%w: clock %s", ErrSilenceInvalid, clock)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// 解析星期，支持全称及前三个字母
+func parseWeekday(weekday string) (time.Weekday, error) {
+	name := strings.ToLower(strings.TrimSpace(weekday))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		full := strings.ToLower(day.String())
+		if name == full || name == full[:3] {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: weekday %s", ErrSilenceInvalid, weekday)
+}
+
+// 是否包含星期
+func (silence *Silence) onWeekday(day time.Weekday) bool {
+	if len(silence.Weekdays) == 0 {
+		return true
+	}
+	for _, weekday := range silence.Weekdays {
+		d, err := parseWeekday(weekday)
+		if err == nil && d == day {
+			return true
+		}
+	}
+	return false
+}
+
+// 是否生效
+func (silence *Silence) IsActive(now time.Time) bool {
+	if !silence.StartsAt.IsZero() && now.Before(silence.StartsAt) {
+		return false
+	}
+	if !silence.EndsAt.IsZero() && !now.Before(silence.EndsAt) {
+		return false
+	}
+	if !silence.IsRecurring() {
+		return true
+	}
+	from, err := parseClock(silence.From)
+	if err != nil {
+		return false
+	}
+	to, err := parseClock(silence.To)
+	if err != nil {
+		return false
+	}
+	now = now.Local()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	clock := now.Sub(midnight)
+	if from < to {
+		return silence.onWeekday(now.Weekday()) && clock >= from && clock < to
+	}
+	// 跨天窗口，星期按开始时刻所在日期计算
+	if clock >= from {
+		return silence.onWeekday(now.Weekday())
+	}
+	return clock < to && silence.onWeekday(midnight.AddDate(0, 0, -1).Weekday())
+}
+
+// 是否已过期，结束时间已过的静默不会再生效
+func (silence *Silence) IsExpired(now time.Time) bool {
+	return !silence.EndsAt.IsZero() && !now.Before(silence.EndsAt)
+}
+
+// 是否匹配监控及数据源
+func (silence *Silence) Matches(watcher *WatcherConfig, datasource string) bool {
+	if silence.App != "" && silence.App != watcher.App {
+		return false
+	}
+	if silence.System != "" && silence.System != watcher.System {
+		return false
+	}
+	if silence.Provider != "" && silence.Provider != watcher.Provider {
+		return false
+	}
+	if silence.Datasource != "" && silence.Datasource != datasource {
+		return false
+	}
+	if len(silence.Tags) > 0 && !slices.ContainsFunc(silence.Tags, func(tag string) bool {
+		return slices.Contains(watcher.Tags, tag)
+	}) {
+		return false
+	}
+	return true
+}
+
+// 查找生效且匹配的静默
+func FindSilence(silences []*Silence, watcher *WatcherConfig, datasource string, now time.Time) *Silence {
+	for _, silence := range silences {
+		if silence.IsActive(now) && silence.Matches(watcher, datasource) {
+			return silence
+		}
+	}
+	return nil
+}
@@ -0,0 +1,325 @@
+package modules
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var (
+	ErrSinkNotFound   = errors.New("sink not found")
+	ErrSinkNotSupport = errors.New("sink not support")
+)
+
+var (
+	SinkTypeFile   = "file"
+	SinkTypeStdout = "stdout"
+	SinkTypeMemory = "memory"
+	SinkTypeInflux = "influxdb"
+	SinkTypeMQTT   = "mqtt"
+	SinkTypeKafka  = "kafka"
+)
+
+// 内置Elasticsearch输出名称
+const SinkElastic = "elastic"
+
+// 内存输出默认保留条数
+const SinkDefaultMemoryLimit = 1000
+
+// 监控结果输出
+type Sink interface {
+	Write(watcher *WatcherConfig, datas []ExpiredData) error
+}
+
+// 输出配置
+type SinkConfig struct {
+	Name          string   `yaml:"Name"`                    // 名称，监控按名称选择输出
+	Type          string   `yaml:"Type"`                    // 类型（file/stdout/memory/influxdb/mqtt/kafka）
+	Path          string   `yaml:"Path,omitempty"`          // 文件路径（file），每行一条json
+	Limit         int      `yaml:"Limit,omitempty"`         // 保留条数（memory），默认1000
+	Url           string   `yaml:"Url,omitempty"`           // 地址，如http://127.0.0.1:8086（influxdb）、tcp://127.0.0.1:1883（mqtt）
+	Database      string   `yaml:"Database,omitempty"`      // 数据库（influxdb 1.x）
+	Org           string   `yaml:"Org,omitempty"`           // 组织（influxdb 2.x）
+	Bucket        string   `yaml:"Bucket,omitempty"`        // 存储桶（influxdb 2.x）
+	Token         string   `yaml:"Token,omitempty"`         // 令牌（influxdb 2.x）
+	Username      string   `yaml:"Username,omitempty"`      // 用户名
+	Password      string   `yaml:"Password,omitempty"`      // 密码
+	Measurement   string   `yaml:"Measurement,omitempty"`   // measurement（influxdb），默认expired_data
+	Brokers       []string `yaml:"Brokers,omitempty"`       // broker地址（kafka），如127.0.0.1:9092
+	Topic         string   `yaml:"Topic,omitempty"`         // 结果主题模板，mqtt默认datawatcher/{System}/{App}/{Datasource}，kafka默认datawatcher
+	AlertTopic    string   `yaml:"AlertTopic,omitempty"`    // 告警主题模板（mqtt），默认datawatcher/{System}/{App}/alerts/{Rule}
+	QoS           byte     `yaml:"QoS,omitempty"`           // 服务质量（mqtt），0/1/2
+	Retain        bool     `yaml:"Retain,omitempty"`        // 是否保留最后一条消息（mqtt）
+	ClientID      string   `yaml:"ClientID,omitempty"`      // 客户端编号，mqtt默认datawatcher-主机名-名称，kafka默认datawatcher
+	Compression   string   `yaml:"Compression,omitempty"`   // 压缩方式（kafka），none/gzip/snappy/zstd
+	SASL          string   `yaml:"SASL,omitempty"`          // SASL认证方式（kafka），plain/scram-sha-256/scram-sha-512
+	TLS           bool     `yaml:"TLS,omitempty"`           // 是否使用TLS（kafka），配置证书时自动启用
+	CACert        string   `yaml:"CACert,omitempty"`        // CA证书路径
+	Cert          string   `yaml:"Cert,omitempty"`          // 客户端证书路径
+	Key           string   `yaml:"Key,omitempty"`           // 客户端私钥路径
+	SkipVerify    bool     `yaml:"SkipVerify,omitempty"`    // 是否跳过证书校验
+	BatchSize     int      `yaml:"BatchSize,omitempty"`     // 批量写入条数，默认500
+	FlushInterval int      `yaml:"FlushInterval,omitempty"` // 定时写入间隔(s)，默认5s
+	QueueSize     int      `yaml:"QueueSize,omitempty"`     // 缓冲容量，默认10000，超出时丢弃
+	Retries       *int     `yaml:"Retries,omitempty"`       // 失败重试次数，默认3次
+	Timeout       int      `yaml:"Timeout,omitempty"`       // 超时时间(s)，默认10s
+}
+
+// 校验输出配置
+func (conf *SinkConfig) Validate() error {
+	if conf.Name == "" {
+		return fmt.Errorf("%w: sink has no name", ErrSinkNotSupport)
+	}
+	if conf.Name == SinkElastic {
+		return fmt.Errorf("%w: sink name %s is reserved", ErrSinkNotSupport, conf.Name)
+	}
+	switch conf.Type {
+	case SinkTypeFile:
+		if conf.Path == "" {
+			return fmt.Errorf("%w: sink %s has no path", ErrSinkNotSupport, conf.Name)
+		}
+	case SinkTypeInflux:
+		return conf.validateInflux()
+	case SinkTypeMQTT:
+		return conf.validateMQTT()
+	case SinkTypeKafka:
+		return conf.validateKafka()
+	case SinkTypeStdout, SinkTypeMemory:
+	default:
+		return fmt.Errorf("%w: %s", ErrSinkNotSupport, conf.Type)
+	}
+	return nil
+}
+
+// 按配置创建输出
+func (conf *SinkConfig) New() (Sink, error) {
+	err := conf.Validate()
+	if err != nil {
+		return nil, err
+	}
+	switch conf.Type {
+	case SinkTypeFile:
+		return &FileSink{Path: conf.Path}, nil
+	case SinkTypeStdout:
+		return &WriterSink{Writer: os.Stdout}, nil
+	case SinkTypeInflux:
+		return NewInfluxSink(conf), nil
+	case SinkTypeMQTT:
+		return NewMQTTSink(conf)
+	case SinkTypeKafka:
+		return NewKafkaSink(conf)
+	default:
+		return NewMemorySink(conf.Limit), nil
+	}
+}
+
+// 写入Elasticsearch，索引为应用名称，队列满时丢弃并继续写入其余数据
+func (conf *Elastic) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	dropped := 0
+	for _, data := range datas {
+		err := conf.Log(watcher.App, data)
+		if errors.Is(err, ErrElasticQueueFull) {
+			dropped++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if dropped > 0 {
+		return fmt.Errorf("%w: %d documents dropped", ErrElasticQueueFull, dropped)
+	}
+	return nil
+}
+
+// 以NDJSON写入io.Writer
+type WriterSink struct {
+	Mutex  sync.Mutex
+	Writer io.Writer
+}
+
+func (sink *WriterSink) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	sink.Mutex.Lock()
+	defer sink.Mutex.Unlock()
+	return writeNDJSON(sink.Writer, datas)
+}
+
+func writeNDJSON(w io.Writer, datas []ExpiredData) error {
+	buf := bufio.NewWriter(w)
+	encoder := json.NewEncoder(buf)
+	for _, data := range datas {
+		err := encoder.Encode(data)
+		if err != nil {
+			return err
+		}
+	}
+	return buf.Flush()
+}
+
+// 以NDJSON追加写入文件
+type FileSink struct {
+	Mutex sync.Mutex
+	Path  string
+	file  *os.File
+}
+
+func (sink *FileSink) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	sink.Mutex.Lock()
+	defer sink.Mutex.Unlock()
+	if sink.file == nil {
+		err := os.MkdirAll(filepath.Dir(sink.Path), 0755)
+		if err != nil {
+			return err
+		}
+		file, err := os.OpenFile(sink.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		sink.file = file
+	}
+	return writeNDJSON(sink.file, datas)
+}
+
+// 保存在内存中，超出保留条数时丢弃最早的数据，用于测试及调试
+type MemorySink struct {
+	Mutex sync.Mutex
+	Limit int
+	Datas []ExpiredData
+}
+
+func NewMemorySink(limit int) *MemorySink {
+	if limit <= 0 {
+		limit = SinkDefaultMemoryLimit
+	}
+	return &MemorySink{
+		Limit: limit,
+		Datas: make([]ExpiredData, 0),
+	}
+}
+
+func (sink *MemorySink) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	sink.Mutex.Lock()
+	defer sink.Mutex.Unlock()
+	sink.Datas = append(sink.Datas, datas...)
+	if len(sink.Datas) > sink.Limit {
+		sink.Datas = append([]ExpiredData(nil), sink.Datas[len(sink.Datas)-sink.Limit:]...)
+	}
+	return nil
+}
+
+// 获取已保存的数据
+func (sink *MemorySink) GetDatas() []ExpiredData {
+	sink.Mutex.Lock()
+	defer sink.Mutex.Unlock()
+	return append([]ExpiredData(nil), sink.Datas...)
+}
+
+// 输出管理，按监控配置将结果分发到多个输出
+type SinkManager struct {
+	Sinks   map[string]Sink // 输出，按名称索引
+	Elastic *Elastic        // Elasticsearch，另用于记录错误日志
+}
+
+// 按配置创建输出，elastic作为内置输出，配置错误的输出记录日志后跳过
+func NewSinkManager(configs *[]*SinkConfig, elastic *Elastic) *SinkManager {
+	manager := &SinkManager{
+		Sinks:   map[string]Sink{},
+		Elastic: elastic,
+	}
+	if elastic != nil {
+		manager.Sinks[SinkElastic] = elastic
+	}
+	if configs == nil {
+		return manager
+	}
+	for _, conf := range *configs {
+		sink, err := conf.New()
+		if err != nil {
+			log.Printf("Create sink %s failed: %v", conf.Name, err)
+			continue
+		}
+		manager.Sinks[conf.Name] = sink
+	}
+	return manager
+}
+
+// 添加输出
+func (manager *SinkManager) Add(name string, sink Sink) {
+	manager.Sinks[name] = sink
+}
+
+// 校验输出名称
+func (manager *SinkManager) CheckSinks(names []string) error {
+	for _, name := range names {
+		if _, ok := manager.Sinks[name]; !ok {
+			return fmt.Errorf("%w: %s", ErrSinkNotFound, name)
+		}
+	}
+	return nil
+}
+
+// 校验监控的结果主题模板，选择Kafka输出时需符合Kafka主题命名规则
+func (manager *SinkManager) CheckTopic(watcher *WatcherConfig) error {
+	if watcher.Topic == "" {
+		return nil
+	}
+	for _, name := range watcher.GetSinks() {
+		if _, ok := manager.Sinks[name].(*KafkaSink); ok {
+			return ValidateKafkaTopic(watcher.Topic)
+		}
+	}
+	return nil
+}
+
+// 写入监控选择的全部输出，单个输出失败不影响其他输出
+func (manager *SinkManager) Write(watcher *WatcherConfig, datas []ExpiredData) error {
+	if manager == nil || len(datas) == 0 {
+		return nil
+	}
+	errs := make([]error, 0)
+	for _, name := range watcher.GetSinks() {
+		sink, ok := manager.Sinks[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%w: %s", ErrSinkNotFound, name))
+			continue
+		}
+		err := sink.Write(watcher, datas)
+		if err != nil {
+			metricSinkFailures.WithLabelValues(name).Inc()
+			errs = append(errs, fmt.Errorf("sink %s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// 将告警状态变化写入监控选择的输出中支持告警的输出
+func (manager *SinkManager) Notify(event AlertEvent) {
+	if manager == nil {
+		return
+	}
+	for _, name := range event.Watcher.GetSinks() {
+		sink, ok := manager.Sinks[name].(AlertSink)
+		if !ok {
+			continue
+		}
+		err := sink.WriteAlert(event)
+		if err != nil {
+			metricSinkFailures.WithLabelValues(name).Inc()
+			log.Printf("Write alert %s/%s to sink %s failed: %v", event.Alert.App, event.Alert.Rule, name, err)
+		}
+	}
+}
+
+// 记录错误日志
+func (manager *SinkManager) NewError(info string, detail string, extend interface{}) {
+	if manager == nil || manager.Elastic == nil {
+		return
+	}
+	manager.Elastic.NewError(info, detail, extend)
+}
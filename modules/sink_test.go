@@ -0,0 +1,72 @@
+package modules
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSinkManagerFanOut(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.ndjson")
+	manager := NewSinkManager(&[]*SinkConfig{
+		{Name: "file", Type: SinkTypeFile, Path: path},
+		{Name: "mem", Type: SinkTypeMemory, Limit: 2},
+	}, nil)
+	watcher := &WatcherConfig{App: "fanout", Sinks: []string{"file", "mem"}}
+	datas := []ExpiredData{
+		{Datasource: "A", Buckets: map[string]int{"Expire1Day": 1}},
+		{Datasource: "B", Buckets: map[string]int{"Expire1Day": 2}},
+		{Datasource: "C", Buckets: map[string]int{"Expire1Day": 3}},
+	}
+	err := manager.Write(watcher, datas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mem := manager.Sinks["mem"].(*MemorySink).GetDatas()
+	if len(mem) != 2 || mem[0].Datasource != "B" || mem[1].Datasource != "C" {
+		t.Errorf("unexpected memory sink datas %v", mem)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	lines := 0
+	for scanner.Scan() {
+		var data ExpiredData
+		err := json.Unmarshal(scanner.Bytes(), &data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data.Datasource != datas[lines].Datasource {
+			t.Errorf("line %d: unexpected datasource %s", lines, data.Datasource)
+		}
+		lines++
+	}
+	if lines != len(datas) {
+		t.Errorf("expected %d lines, got %d", len(datas), lines)
+	}
+}
+
+func TestSinkManagerUnknownSink(t *testing.T) {
+	manager := NewSinkManager(&[]*SinkConfig{
+		{Name: "mem", Type: SinkTypeMemory},
+	}, nil)
+	err := manager.CheckSinks([]string{"mem", "missing"})
+	if !errors.Is(err, ErrSinkNotFound) {
+		t.Errorf("expected ErrSinkNotFound, got %v", err)
+	}
+	// 未知输出不影响其他输出
+	watcher := &WatcherConfig{App: "unknown", Sinks: []string{"missing", "mem"}}
+	err = manager.Write(watcher, []ExpiredData{{Datasource: "A"}})
+	if !errors.Is(err, ErrSinkNotFound) {
+		t.Errorf("expected ErrSinkNotFound, got %v", err)
+	}
+	if len(manager.Sinks["mem"].(*MemorySink).GetDatas()) != 1 {
+		t.Error("memory sink should receive data")
+	}
+}
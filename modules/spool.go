@@ -0,0 +1,383 @@
+package modules
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrElasticSpoolFull = errors.New("elastic spool is full")
+
+// 落盘默认目录
+const ElasticDefaultSpoolPath = "./spool"
+
+// 落盘默认容量上限(MB)
+const ElasticDefaultSpoolSize = 512
+
+// 单个落盘文件大小上限，超过后新建文件
+const spoolSegmentSize = 8 << 20
+
+// 落盘文件扩展名
+const spoolSegmentExt = ".spool"
+
+// 落盘记录，每行一条
+type spoolRecord struct {
+	Time  int64           `json:"t"` // 入队时间(ms)
+	Index string          `json:"i"` // 索引
+	Body  json.RawMessage `json:"b"` // 文档
+}
+
+// Elasticsearch不可用时的落盘队列，按文件编号及行顺序回放
+// 回放进度保存在offset文件中，重启后从上次位置继续
+type elasticSpool struct {
+	path     string
+	maxSize  int64
+	mutex    sync.Mutex
+	segments []uint64 // 落盘文件编号，升序
+	offset   int64    // 首个文件已回放字节数
+	size     int64    // 待回放字节数
+	count    int      // 待回放文档数
+	writer   *os.File // 当前写入文件
+	written  int64    // 当前写入文件大小
+}
+
+func (conf *Elastic) getSpoolPath() string {
+	if conf.SpoolPath == "" {
+		return ElasticDefaultSpoolPath
+	}
+	return conf.SpoolPath
+}
+
+func (conf *Elastic) getSpoolSize() int64 {
+	if conf.SpoolSize <= 0 {
+		return ElasticDefaultSpoolSize << 20
+	}
+	return int64(conf.SpoolSize) << 20
+}
+
+// 打开落盘目录，统计未回放的文档
+func openSpool(path string, maxSize int64) (*elasticSpool, error) {
+	err := os.MkdirAll(path, 0755)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	spool := &elasticSpool{
+		path:     path,
+		maxSize:  maxSize,
+		segments: make([]uint64, 0),
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, spoolSegmentExt) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(name, spoolSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		spool.segments = append(spool.segments, seq)
+	}
+	sort.Slice(spool.segments, func(i, j int) bool {
+		return spool.segments[i] < spool.segments[j]
+	})
+	head, offset := spool.readOffset()
+	if len(spool.segments) > 0 && spool.segments[0] == head {
+		spool.offset = offset
+	}
+	for i, seq := range spool.segments {
+		var start int64
+		if i == 0 {
+			start = spool.offset
+		}
+		size, count, err := countLines(spool.segmentPath(seq), start)
+		if err != nil {
+			return nil, err
+		}
+		spool.size += size
+		spool.count += count
+	}
+	return spool, nil
+}
+
+// 统计文件自start起的字节数及行数
+func countLines(path string, start int64) (int64, int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer file.Close()
+	_, err = file.Seek(start, io.SeekStart)
+	if err != nil {
+		return 0, 0, err
+	}
+	var size int64
+	var count int
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := file.Read(buf)
+		size += int64(n)
+		count += bytes.Count(buf[:n], []byte{'\n'})
+		if err == io.EOF {
+			return size, count, nil
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+}
+
+func (spool *elasticSpool) segmentPath(seq uint64) string {
+	return filepath.Join(spool.path, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// 读取回放进度，格式为“文件编号 偏移”
+func (spool *elasticSpool) readOffset() (uint64, int64) {
+	data, err := os.ReadFile(filepath.Join(spool.path, "offset"))
+	if err != nil {
+		return 0, 0
+	}
+	var seq uint64
+	var offset int64
+	_, err = fmt.Sscanf(string(data), "%d %d", &seq, &offset)
+	if err != nil {
+		return 0, 0
+	}
+	return seq, offset
+}
+
+func (spool *elasticSpool) writeOffset() error {
+	var seq uint64
+	if len(spool.segments) > 0 {
+		seq = spool.segments[0]
+	}
+	tmp := filepath.Join(spool.path, "offset.tmp")
+	err := os.WriteFile(tmp, []byte(fmt.Sprintf("%d %d", seq, spool.offset)), 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(spool.path, "offset"))
+}
+
+// 待回放文档数
+func (spool *elasticSpool) depth() int {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	return spool.count
+}
+
+// 追加文档，超出容量上限的文档丢弃，返回写入条数
+func (spool *elasticSpool) append(docs []*bulkDoc) (int, error) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	var buf bytes.Buffer
+	written := 0
+	for _, doc := range docs {
+		line, err := json.Marshal(spoolRecord{
+			Time:  doc.at.UnixMilli(),
+			Index: doc.index,
+			Body:  json.RawMessage(bytes.TrimRight(doc.body, "\n")),
+		})
+		if err != nil {
+			continue
+		}
+		if spool.size+int64(buf.Len()+len(line)+1) > spool.maxSize {
+			break
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		written++
+	}
+	if buf.Len() == 0 {
+		if written < len(docs) {
+			return 0, ErrElasticSpoolFull
+		}
+		return 0, nil
+	}
+	if spool.writer == nil || spool.written >= spoolSegmentSize {
+		err := spool.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	_, err := spool.writer.Write(buf.Bytes())
+	if err == nil {
+		err = spool.writer.Sync()
+	}
+	if err != nil {
+		return 0, err
+	}
+	spool.written += int64(buf.Len())
+	spool.size += int64(buf.Len())
+	spool.count += written
+	if written < len(docs) {
+		return written, ErrElasticSpoolFull
+	}
+	return written, nil
+}
+
+// 新建写入文件，重启后不续写旧文件，避免接在不完整的行之后
+func (spool *elasticSpool) rotate() error {
+	if spool.writer != nil {
+		spool.writer.Close()
+		spool.writer = nil
+	}
+	var seq uint64 = 1
+	if len(spool.segments) > 0 {
+		seq = spool.segments[len(spool.segments)-1] + 1
+	}
+	file, err := os.OpenFile(spool.segmentPath(seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	spool.segments = append(spool.segments, seq)
+	spool.writer = file
+	spool.written = 0
+	return nil
+}
+
+// 读取最早的至多n条文档，返回文档、占用字节数及行数，回放成功后调用commit
+func (spool *elasticSpool) peek(n int) ([]*bulkDoc, int64, int, error) {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	for len(spool.segments) > 0 {
+		docs, consumed, lines, eof, err := spool.readHead(n)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		if consumed > 0 || !eof || spool.isWriting() {
+			return docs, consumed, lines, nil
+		}
+		// 首个文件已回放完毕
+		err = spool.removeHead()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+	}
+	return nil, 0, 0, nil
+}
+
+// 是否正在写入首个文件
+func (spool *elasticSpool) isWriting() bool {
+	return spool.writer != nil && len(spool.segments) == 1
+}
+
+// 从首个文件的回放位置读取，无法解析的记录跳过
+func (spool *elasticSpool) readHead(n int) ([]*bulkDoc, int64, int, bool, error) {
+	file, err := os.Open(spool.segmentPath(spool.segments[0]))
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+	defer file.Close()
+	_, err = file.Seek(spool.offset, io.SeekStart)
+	if err != nil {
+		return nil, 0, 0, false, err
+	}
+	reader := bufio.NewReader(file)
+	docs := make([]*bulkDoc, 0, n)
+	var consumed int64
+	var lines int
+	for len(docs) < n {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			// 非写入中的文件末尾不完整的行为异常退出残留，直接跳过
+			if len(line) > 0 && !spool.isWriting() {
+				log.Printf("Skip incomplete spool record in %d", spool.segments[0])
+				consumed += int64(len(line))
+			}
+			return docs, consumed, lines, true, nil
+		}
+		if err != nil {
+			return nil, 0, 0, false, err
+		}
+		consumed += int64(len(line))
+		lines++
+		var record spoolRecord
+		err = json.Unmarshal(line, &record)
+		if err != nil {
+			log.Printf("Skip invalid spool record: %v", err)
+			continue
+		}
+		docs = append(docs, &bulkDoc{
+			index: record.Index,
+			body:  record.Body,
+			at:    time.UnixMilli(record.Time),
+		})
+	}
+	return docs, consumed, lines, false, nil
+}
+
+// 删除已回放完毕的首个文件
+func (spool *elasticSpool) removeHead() error {
+	err := os.Remove(spool.segmentPath(spool.segments[0]))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	spool.segments = spool.segments[1:]
+	spool.offset = 0
+	return spool.writeOffset()
+}
+
+// 确认已回放peek返回的文档
+func (spool *elasticSpool) commit(consumed int64, lines int) error {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	spool.offset += consumed
+	spool.size -= consumed
+	spool.count -= lines
+	if spool.count == 0 && spool.writer != nil {
+		// 全部回放完毕，关闭写入文件以便删除
+		spool.writer.Close()
+		spool.writer = nil
+	}
+	return spool.writeOffset()
+}
+
+// 最早文档的入队时间，无文档时为零值
+func (spool *elasticSpool) oldest() time.Time {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	if spool.count == 0 {
+		return time.Time{}
+	}
+	for i, seq := range spool.segments {
+		file, err := os.Open(spool.segmentPath(seq))
+		if err != nil {
+			return time.Time{}
+		}
+		if i == 0 {
+			file.Seek(spool.offset, io.SeekStart)
+		}
+		line, err := bufio.NewReader(file).ReadBytes('\n')
+		file.Close()
+		if err != nil {
+			continue
+		}
+		var record spoolRecord
+		if json.Unmarshal(line, &record) == nil {
+			return time.UnixMilli(record.Time).Local()
+		}
+	}
+	return time.Time{}
+}
+
+// 落盘占用字节数
+func (spool *elasticSpool) usage() int64 {
+	spool.mutex.Lock()
+	defer spool.mutex.Unlock()
+	return spool.size
+}
@@ -1,11 +1,11 @@
 package modules
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log"
 	"strconv"
 	"strings"
 	"sync"
@@ -15,9 +15,10 @@ import (
 )
 
 var (
-	ErrWatcherNotFound = errors.New("watcher not found")
-	ErrWatcherDisabled = errors.New("watcher is disabled")
-	ErrWatcherNoCron   = errors.New("watcher has no cron expression")
+	ErrWatcherNotFound       = errors.New("watcher not found")
+	ErrWatcherDisabled       = errors.New("watcher is disabled")
+	ErrWatcherNoCron         = errors.New("watcher has no cron expression")
+	ErrWatcherRequestInvalid = errors.New("watcher request template is invalid")
 )
 
 var Watchers *[]WatcherConfig
@@ -39,67 +40,111 @@ type WatcherDataConfig struct {
 
 // 监控配置
 type WatcherConfig struct {
-	Mutex          sync.Mutex   `yaml:"-" json:"-"` // 互斥锁
-	Module         string       `yaml:"Module"`     // 模块
-	System         string       `yaml:"System"`     // 系统
-	Provider       string       `yaml:"Provider"`   // 提供方
-	Requester      string       `yaml:"Requester"`  // 请求方
-	Type           string       `yaml:"Type"`       // 类型（Push/Pull）
-	Method         string       `yaml:"Method"`     // 承载方式
-	App            string       `yaml:"App"`        // 应用名称
-	Desc           string       `yaml:"Desc"`       // 描述
-	Interface      string       `yaml:"Interface"`  // 接口名称
-	ConfigPath     string       `yaml:"ConfigPath"` // 配置路径
-	Tags           []string     `yaml:"Tags"`       // 标签
-	Sources        []string     `yaml:"Sources"`    // 数据源编号列表
-	GetExpired     string       `yaml:"GetExpired"` // 获取呆滞数据SQL
-	Extend         interface{}  `yaml:"Extend"`     // 扩展字段
-	Cron           string       `yaml:"Cron"`       // Cron表达式
-	Enabled        bool         `yaml:"Enabled"`    // 是否启用
-	EntryID        cron.EntryID `yaml:"-"`          // Cron运行时ID
-	Count          int64        `yaml:"-"`          // 运行次数
-	PrevDuration   int64        `yaml:"-"`          // 上次运行耗时(ms)
-	DurationAvg    int64        `yaml:"-"`          // 运行平均耗时(ms)
-	SqlDurationAvg int64        `yaml:"-"`          // SQL运行平均耗时(ms)
+	Mutex        sync.Mutex       `yaml:"-" json:"-"`           // 互斥锁
+	Module       string           `yaml:"Module"`               // 模块
+	System       string           `yaml:"System"`               // 系统
+	Provider     string           `yaml:"Provider"`             // 提供方
+	Requester    string           `yaml:"Requester"`            // 请求方
+	Type         string           `yaml:"Type"`                 // 类型（Push/Pull）
+	Method       string           `yaml:"Method"`               // 承载方式
+	App          string           `yaml:"App"`                  // 应用名称
+	Desc         string           `yaml:"Desc"`                 // 描述
+	Interface    string           `yaml:"Interface"`            // 接口名称
+	ConfigPath   string           `yaml:"ConfigPath"`           // 配置路径
+	Tags         []string         `yaml:"Tags"`                 // 标签
+	Sources      []string         `yaml:"Sources"`              // 数据源编号列表
+	GetExpired   string           `yaml:"GetExpired"`           // 获取呆滞数据SQL
+	Extend       interface{}      `yaml:"Extend"`               // 扩展字段
+	Request      string           `yaml:"Request,omitempty"`    // 请求体模板（api/soap），覆盖数据源Body
+	SOAPAction   string           `yaml:"SOAPAction,omitempty"` // SOAPAction请求头，覆盖数据源配置
+	Mapping      *ResponseMapping `yaml:"Mapping,omitempty"`    // 响应映射（api/soap）
+	Patterns     []string         `yaml:"Patterns,omitempty"`   // 文件匹配模式（filesystem），覆盖数据源配置
+	Buckets      []Bucket         `yaml:"Buckets,omitempty"`    // 滞留时长分段，默认Expire1Day/Expire1Week/Expire1Month
+	Alerts       []AlertRule      `yaml:"Alerts,omitempty"`     // 告警规则
+	Channels     []string         `yaml:"Channels,omitempty"`   // 通知渠道名称，另可由渠道按标签订阅
+	Sinks        []string         `yaml:"Sinks,omitempty"`      // 结果输出名称，默认elastic
+	Topic        string           `yaml:"Topic,omitempty"`      // 结果主题模板（kafka），覆盖输出配置
+	Cron         string           `yaml:"Cron"`                 // Cron表达式（秒 分 时 日 月 周），另支持@daily、@every 5m等，兼容3段（秒 分 时）
+	Enabled      bool             `yaml:"Enabled"`              // 是否启用
+	EntryID      cron.EntryID     `yaml:"-"`                    // Cron运行时ID
+	Count        int64            `yaml:"-"`                    // 运行次数
+	PrevDuration int64            `yaml:"-"`                    // 上次运行耗时(ms)，耗时分布见/metrics
+	Latest       []ExpiredData    `yaml:"-" json:"-"`           // 最近一次运行结果
 }
 
 // 从api获取数据
 func (watcher *WatcherConfig) GetExpiredDataFromAPI(datasource *Datasource) (*[]ExpiredData, error) {
-	resp, err := http.Get(datasource.Url)
+	_, _bytes, err := datasource.Request(context.Background(), &APIRequestData{
+		Watcher:    watcher,
+		Datasource: datasource,
+		Now:        time.Now().Local(),
+	})
 	if err != nil {
 		// watcher.Elastic.NewError("Get expired data failed", err.Error(), watcher)
 		return nil, err
 	}
-	defer resp.Body.Close()
 	var datas []ExpiredData
-	_bytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		// watcher.Elastic.NewError("Get expired data failed", err.Error(), nil)
-		return nil, err
+	if watcher.Mapping != nil {
+		rows, err := watcher.Mapping.MapJSON(_bytes)
+		if err != nil {
+			return nil, err
+		}
+		datas = make([]ExpiredData, len(rows))
+		for i, row := range rows {
+			datas[i] = watcher.NewExpiredData(datasource, row)
+		}
+		return &datas, nil
 	}
 	err = json.Unmarshal(_bytes, &datas)
 	if err != nil {
 		// watcher.Elastic.NewError("Get expired data failed", err.Error(), nil)
 		return nil, err
 	}
-	for _, data := range datas {
-		if data.Datasource != datasource.Code {
-			data.Datasource = datasource.Code
+	now := time.Now().Local()
+	for i := range datas {
+		datas[i].Datasource = datasource.Code
+		datas[i].WatcherConfig = watcher
+		if datas[i].TimeStamp.IsZero() {
+			datas[i].TimeStamp = now
 		}
+		datas[i].FillBuckets(watcher.GetBuckets())
+	}
+	return &datas, nil
+}
+
+// 从soap接口获取数据
+func (watcher *WatcherConfig) GetExpiredDataFromSOAP(datasource *Datasource) (*[]ExpiredData, error) {
+	_, _bytes, err := datasource.Request(context.Background(), &APIRequestData{
+		Watcher:    watcher,
+		Datasource: datasource,
+		Now:        time.Now().Local(),
+	})
+	if err != nil {
+		return nil, err
+	}
+	mapping := watcher.Mapping
+	if mapping == nil {
+		mapping = DefaultXMLMapping
+	}
+	rows, err := mapping.MapXML(_bytes)
+	if err != nil {
+		return nil, err
+	}
+	datas := make([]ExpiredData, len(rows))
+	for i, row := range rows {
+		datas[i] = watcher.NewExpiredData(datasource, row)
 	}
 	return &datas, nil
 }
 
 // 从数据库获取数据
 func (watcher *WatcherConfig) GetExpiredDataFromSQL(datasource *Datasource) (*[]ExpiredData, error) {
-	if datasource.DB == nil {
-		db, err := datasource.Connect()
-		if err != nil {
-			fmt.Printf("Connect %s db failed: %s\n", datasource.Code, err.Error())
-		}
-		datasource.DB = db
+	db, err := datasource.GetDB()
+	if err != nil {
+		fmt.Printf("Connect %s db failed: %s\n", datasource.Code, err.Error())
+		return nil, err
 	}
-	err := datasource.DB.Ping()
+	err = db.Ping()
 	if err != nil {
 		// watcher.Elastic.NewError("Get expired data failed", err.Error(), map[string]interface{}{
 		// 	"DSN": watcher.DataConfig.DSN,
@@ -111,7 +156,7 @@ func (watcher *WatcherConfig) GetExpiredDataFromSQL(datasource *Datasource) (*[]
 	datas := make([]ExpiredData, 0)
 	// 临时存储，获取所有平铺键值对，后续解析
 	var temp map[string]interface{}
-	rows, err := datasource.DB.Query(watcher.GetExpired)
+	rows, err := db.Query(watcher.GetExpired)
 	if err != nil {
 		fmt.Printf("Get %s expited failed: %s\n", watcher.App, err.Error())
 	}
@@ -119,6 +164,7 @@ func (watcher *WatcherConfig) GetExpiredDataFromSQL(datasource *Datasource) (*[]
 		return &datas, nil
 	}
 	cols, _ := rows.Columns()
+	colTypes, _ := rows.ColumnTypes()
 	vals := make([]interface{}, len(cols))
 	// res := make([]map[string]interface{}, 0)
 	for i := range cols {
@@ -132,20 +178,14 @@ func (watcher *WatcherConfig) GetExpiredDataFromSQL(datasource *Datasource) (*[]
 			col := cols[i]
 			switch v := v.(type) {
 			case *(interface{}):
-				temp[col] = *v
+				typeName := ""
+				if i < len(colTypes) {
+					typeName = colTypes[i].DatabaseTypeName()
+				}
+				temp[col] = parseValue(*v, typeName)
 			}
 		}
-		parsedInterface := parseInterface(temp)
-		extend := parsedInterface["Extend"]
-		data := ExpiredData{
-			Datasource:    datasource.Code,
-			WatcherConfig: watcher,
-			TimeStamp:     time.Now().Local(),
-			Expire1Day:    parseInt(parsedInterface["Expire1Day"]),
-			Expire1Week:   parseInt(parsedInterface["Expire1Week"]),
-			Expire1Month:  parseInt(parsedInterface["Expire1Month"]),
-			Extend:        extend,
-		}
+		data := watcher.NewExpiredData(datasource, temp)
 		// TEST:
 		// data.Expire1Day = rand.Intn(5)
 		// data.Expire1Week = rand.Intn(5)
@@ -155,55 +195,73 @@ func (watcher *WatcherConfig) GetExpiredDataFromSQL(datasource *Datasource) (*[]
 	return &datas, nil
 }
 
-func (watcher *WatcherConfig) GetExpiredDataFunc(datasources *[]*Datasource, elastic *Elastic) func() {
+// 生成监控运行函数，每次运行记录到运行历史
+func (watcher *WatcherConfig) GetExpiredDataFunc(datasources *[]*Datasource, sinks *SinkManager, alerts *AlertManager, history *History) func(trigger string) *WatcherRun {
 	funcs := make([]func() (*[]ExpiredData, error), len(watcher.Sources))
 	for i, datasourceCode := range watcher.Sources {
 		for _, datasource := range *datasources {
 			if datasourceCode == datasource.Code {
-				funcs[i] = watcher.GenerateGetExpiredDataFunc(datasource, elastic)
+				funcs[i] = watcher.GenerateGetExpiredDataFunc(datasource, sinks)
 				break
 			}
 		}
+		if funcs[i] == nil {
+			// 数据源不存在时每次运行均记录错误，避免监控静默失效
+			funcs[i] = watcher.GenerateDatasourceNotFoundFunc(datasourceCode, sinks)
+		}
 	}
-	return func() {
-		var sqlDurSum, count int64 = 0, 0
-		start := time.Now()
-		for _, fn := range funcs {
+	return func(trigger string) *WatcherRun {
+		var count int64 = 0
+		run := NewWatcherRun(watcher.App, trigger)
+		results := make([]ExpiredData, 0)
+		for i, fn := range funcs {
 			if fn == nil {
 				continue
 			}
 			sqlStart := time.Now()
 			datas, err := fn()
+			source := run.AddSource(watcher.Sources[i], sqlStart, datas, err)
+			observeDatasource(watcher, watcher.Sources[i], source, datas, err)
 			if err != nil {
 				continue
 			}
-			sqlDurSum += (time.Now().UnixNano() - sqlStart.UnixNano()) / 1e6
 			count++
-			if elastic == nil {
-				continue
-			}
-			for _, data := range *datas {
-				go elastic.Log(watcher.App, data)
+			results = append(results, *datas...)
+			err = sinks.Write(watcher, *datas)
+			if err != nil {
+				log.Printf("Write %s results failed: %v", watcher.App, err)
 			}
 		}
+		// 获取失败的数据源不参与评估，保持原告警状态
+		alerts.Evaluate(watcher, results)
+		run.Finish()
+		observeRun(run)
+		err := history.Save(run)
+		if err != nil {
+			log.Printf("Save run of %s failed: %v", watcher.App, err)
+		}
 		if count > 0 {
-			dur := (time.Now().UnixNano() - start.UnixNano()) / 1e6
 			watcher.Mutex.Lock()
 			defer watcher.Mutex.Unlock()
-			watcher.SqlDurationAvg = (watcher.SqlDurationAvg*int64(watcher.Count) + (sqlDurSum / count)) / (watcher.Count + 1)
-			watcher.DurationAvg = (watcher.DurationAvg*int64(watcher.Count) + dur) / (watcher.Count + 1)
 			watcher.Count++
-			watcher.PrevDuration = dur
+			watcher.PrevDuration = run.Duration
+			watcher.Latest = results
 		}
+		return run
 	}
 }
 
 // 生成获取呆滞数据函数
-func (watcher *WatcherConfig) GenerateGetExpiredDataFunc(datasource *Datasource, elastic *Elastic) func() (*[]ExpiredData, error) {
+func (watcher *WatcherConfig) GenerateGetExpiredDataFunc(datasource *Datasource, sinks *SinkManager) func() (*[]ExpiredData, error) {
 	var getDatas func(datasource *Datasource) (*[]ExpiredData, error)
-	if datasource.Type == DataConfigTypeAPI {
+	switch datasource.Type {
+	case DatasourceTypeAPI:
 		getDatas = watcher.GetExpiredDataFromAPI
-	} else {
+	case DatasourceTypeSOAP:
+		getDatas = watcher.GetExpiredDataFromSOAP
+	case DatasourceTypeFilesystem:
+		getDatas = watcher.GetExpiredDataFromFilesystem
+	default:
 		getDatas = watcher.GetExpiredDataFromSQL
 	}
 	return func() (*[]ExpiredData, error) {
@@ -216,20 +274,68 @@ func (watcher *WatcherConfig) GenerateGetExpiredDataFunc(datasource *Datasource,
 				"Type":       datasource.Type,
 				"Code":       datasource.Code,
 			}
-			if elastic != nil {
-				go elastic.NewError("获取数据失败", err.Error(), ext)
-			}
+			go sinks.NewError("获取数据失败", err.Error(), ext)
 			return nil, err
 		}
 		return datas, nil
 	}
 }
 
+// 由平铺键值对生成呆滞数据，带“.”号的键解析为嵌套对象
+func (watcher *WatcherConfig) NewExpiredData(datasource *Datasource, flat map[string]interface{}) ExpiredData {
+	parsedInterface := parseInterface(flat)
+	buckets := watcher.GetBuckets()
+	data := ExpiredData{
+		Datasource:    datasource.Code,
+		WatcherConfig: watcher,
+		TimeStamp:     time.Now().Local(),
+		Buckets:       make(map[string]int, len(buckets)),
+		Extend:        getField(parsedInterface, "Extend"),
+	}
+	for _, bucket := range buckets {
+		data.Buckets[bucket.Name] = parseInt(getField(parsedInterface, bucket.Name))
+	}
+	data.FillBuckets(buckets)
+	return data
+}
+
+// 生成数据源不存在时的获取呆滞数据函数
+func (watcher *WatcherConfig) GenerateDatasourceNotFoundFunc(datasourceCode string, sinks *SinkManager) func() (*[]ExpiredData, error) {
+	return func() (*[]ExpiredData, error) {
+		err := fmt.Errorf("%w: %s", ErrDatasourceNotFound, datasourceCode)
+		fmt.Printf("Get %s expited failed: %s\n", watcher.App, err.Error())
+		go sinks.NewError("获取数据失败", err.Error(), map[string]interface{}{
+			"App":  watcher.App,
+			"Desc": watcher.Desc,
+			"Code": datasourceCode,
+		})
+		return nil, err
+	}
+}
+
+// 获取结果输出名称，未配置时输出到Elasticsearch
+func (watcher *WatcherConfig) GetSinks() []string {
+	if len(watcher.Sinks) == 0 {
+		return []string{SinkElastic}
+	}
+	return watcher.Sinks
+}
+
+// 是否引用数据源
+func (watcher *WatcherConfig) UsesDatasource(datasourceCode string) bool {
+	for _, code := range watcher.Sources {
+		if code == datasourceCode {
+			return true
+		}
+	}
+	return false
+}
+
 // 解析为int
 func parseInt(i interface{}) int {
 	switch v := i.(type) {
 	case *interface{}:
-		return parseInt(i)
+		return parseInt(*v)
 	case int:
 		return v
 	case int8:
@@ -240,19 +346,69 @@ func parseInt(i interface{}) int {
 		return int(v)
 	case int64:
 		return int(v)
+	case uint8:
+		return int(v)
+	case uint16:
+		return int(v)
+	case uint32:
+		return int(v)
+	case uint64:
+		return int(v)
 	case float32:
 		return int(v)
 	case float64:
 		return int(v)
+	case []byte:
+		return parseInt(string(v))
 	case string:
 		val, err := strconv.Atoi(v)
 		if err == nil {
 			return val
 		}
+		// numeric/decimal类型以字符串返回，如"12.00"
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err == nil {
+			return int(f)
+		}
 	}
 	return 0
 }
 
+// 转换驱动返回值，decimal/numeric（以[]byte或字符串返回）转为数值，其余[]byte转为字符串，时间统一为本地时间
+func parseValue(i interface{}, typeName string) interface{} {
+	switch v := i.(type) {
+	case []byte:
+		return parseValue(string(v), typeName)
+	case string:
+		switch strings.ToUpper(typeName) {
+		case "DECIMAL", "NUMERIC", "NUMBER", "MONEY", "SMALLMONEY":
+			if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+				return n
+			}
+			if f, err := strconv.ParseFloat(v, 64); err == nil {
+				return f
+			}
+		}
+		return v
+	case time.Time:
+		return v.Local()
+	}
+	return i
+}
+
+// 获取字段，键名不区分大小写（如PostgreSQL未加引号的别名会转为小写）
+func getField(obj map[string]interface{}, key string) interface{} {
+	if val, ok := obj[key]; ok {
+		return val
+	}
+	for k, val := range obj {
+		if strings.EqualFold(k, key) {
+			return val
+		}
+	}
+	return nil
+}
+
 // 将平铺键值对，递归解析为嵌套对象
 func parseInterface(i map[string]interface{}) map[string]interface{} {
 	obj := map[string]interface{}{}
@@ -296,7 +452,7 @@ func (watcher *WatcherConfig) Enable() error {
 }
 
 // 启动监控
-func (watcher *WatcherConfig) Start(cron *cron.Cron, datasources *[]*Datasource, elastic *Elastic) (cron.EntryID, error) {
+func (watcher *WatcherConfig) Start(cron *cron.Cron, datasources *[]*Datasource, sinks *SinkManager, alerts *AlertManager, history *History) (cron.EntryID, error) {
 	watcher.Mutex.Lock()
 	defer watcher.Mutex.Unlock()
 	if cron == nil {
@@ -316,13 +472,16 @@ func (watcher *WatcherConfig) Start(cron *cron.Cron, datasources *[]*Datasource,
 		// watcher.Elastic.NewError("Start watcher failed", err.Error(), *watcher)
 		return 0, ErrWatcherNoCron
 	}
-	fun := watcher.GetExpiredDataFunc(datasources, elastic)
-	id, err := cron.AddFunc(watcher.Cron, fun)
+	fun := watcher.GetExpiredDataFunc(datasources, sinks, alerts, history)
+	id, err := cron.AddFunc(watcher.Cron, func() {
+		fun(RunTriggerCron)
+	})
 	if err != nil {
 		// watcher.Elastic.NewError("Start watcher failed", err.Error(), *watcher)
 		return 0, err
 	}
 	watcher.EntryID = id
+	metricScheduled.WithLabelValues(watcher.App).Set(1)
 	return id, nil
 }
 
@@ -343,6 +502,7 @@ func (watcher *WatcherConfig) Stop(cron *cron.Cron) {
 			cron.Remove(watcher.EntryID)
 		}
 		watcher.EntryID = 0
+		metricScheduled.WithLabelValues(watcher.App).Set(0)
 	}
 }
 
@@ -354,5 +514,6 @@ type ExpiredData struct {
 	Expire1Day    int            ``                  // 过期1天
 	Expire1Week   int            ``                  // 过期7天
 	Expire1Month  int            ``                  // 过期1个月
+	Buckets       map[string]int ``                  // 分段数量
 	Extend        interface{}    ``                  // 扩展字段
 }
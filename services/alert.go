@@ -0,0 +1,18 @@
+package services
+
+import "server/modules"
+
+type AlertService struct {
+	Alerts *modules.AlertManager
+}
+
+func NewAlertService(alerts *modules.AlertManager) *AlertService {
+	return &AlertService{
+		Alerts: alerts,
+	}
+}
+
+// 获取告警列表
+func (service *AlertService) GetAlerts(all bool) []modules.Alert {
+	return service.Alerts.GetAlerts(all)
+}
@@ -0,0 +1,32 @@
+package services
+
+import "server/modules"
+
+type ChannelService struct {
+	Notifier *modules.Notifier
+}
+
+func NewChannelService(notifier *modules.Notifier) *ChannelService {
+	return &ChannelService{
+		Notifier: notifier,
+	}
+}
+
+// 获取通知渠道列表
+func (service *ChannelService) GetChannels() *[]*modules.Channel {
+	return service.Notifier.Channels
+}
+
+// 发送测试通知
+func (service *ChannelService) TestChannel(name string) (*modules.ChannelTestResult, error) {
+	channel, err := service.Notifier.GetChannel(name)
+	if err != nil {
+		return nil, err
+	}
+	return channel.Test(), nil
+}
+
+// 立即发送汇总报告
+func (service *ChannelService) SendDigest(name string) error {
+	return service.Notifier.SendDigest(name)
+}
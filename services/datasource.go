@@ -1,14 +1,30 @@
 package services
 
-import "server/modules"
+import (
+	"fmt"
+	"server/modules"
+	"slices"
+	"strings"
+	"time"
+)
+
+// 连接测试默认超时时间
+const DatasourceTestTimeout = 10 * time.Second
+
+// 保留的数据源编号，POST /datasources/test用于测试未保存的数据源
+const DatasourceReservedCode = "test"
 
 type DatasourceService struct {
+	Config      *modules.Config
 	Datasources *[]*modules.Datasource
+	Watchers    *[]*modules.WatcherConfig
 }
 
-func NewDatasourceService(datasources *[]*modules.Datasource) *DatasourceService {
+func NewDatasourceService(config *modules.Config, datasources *[]*modules.Datasource, watchers *[]*modules.WatcherConfig) *DatasourceService {
 	return &DatasourceService{
+		Config:      config,
 		Datasources: datasources,
+		Watchers:    watchers,
 	}
 }
 func (service DatasourceService) GetDatasources() []string {
@@ -26,3 +42,138 @@ func (service DatasourceService) GetDatasource(code string) (*modules.Datasource
 	}
 	return nil, modules.ErrDatasourceNotFound
 }
+
+// 获取引用数据源的监控列表
+func (service DatasourceService) GetUsages(code string) []*modules.WatcherConfig {
+	list := make([]*modules.WatcherConfig, 0)
+	if service.Watchers == nil {
+		return list
+	}
+	for _, watcher := range *service.Watchers {
+		if watcher.UsesDatasource(code) {
+			list = append(list, watcher)
+		}
+	}
+	return list
+}
+
+// 校验数据源编号均存在
+func (service DatasourceService) CheckDatasources(codes []string) error {
+	for _, code := range codes {
+		_, err := service.GetDatasource(code)
+		if err != nil {
+			return fmt.Errorf("%w: %s", err, code)
+		}
+	}
+	return nil
+}
+
+// 创建数据源
+func (service *DatasourceService) CreateDatasource(new *modules.Datasource) error {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	new.Code = strings.TrimSpace(new.Code)
+	new.Clear = nil
+	err := new.Validate()
+	if err != nil {
+		return err
+	}
+	if new.Code == DatasourceReservedCode {
+		return fmt.Errorf("%w: %s", modules.ErrDatasourceReserved, new.Code)
+	}
+	old, err := service.GetDatasource(new.Code)
+	if err != nil && err != modules.ErrDatasourceNotFound {
+		return err
+	}
+	if old != nil {
+		return modules.ErrDatasourceDuplicated
+	}
+	datasources := append(*service.Datasources, new)
+	(*service.Datasources) = datasources
+	service.Config.Save()
+	return nil
+}
+
+// 更新数据源，原对象就地更新，已启动的监控无需重启即可使用新配置
+func (service *DatasourceService) UpdateDatasource(code string, new *modules.Datasource) error {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	datasource, err := service.GetDatasource(code)
+	if err != nil {
+		return err
+	}
+	new.Code = code
+	err = new.Validate()
+	if err != nil {
+		return err
+	}
+	for _, field := range new.Clear {
+		if !slices.Contains(modules.DatasourceWriteOnlyFields, field) {
+			return fmt.Errorf("%w: clear %s", modules.ErrDatasourceNotSupport, field)
+		}
+	}
+	// 密码、令牌及连接串只写不读，未传入时沿用原值，列入Clear时清除
+	if new.Password == "" && !slices.Contains(new.Clear, "Password") {
+		new.Password = datasource.Password
+	}
+	if new.DSN == "" && !slices.Contains(new.Clear, "DSN") {
+		new.DSN = datasource.DSN
+	}
+	if new.Token == "" && !slices.Contains(new.Clear, "Token") {
+		new.Token = datasource.Token
+	}
+	datasource.Update(new)
+	service.Config.Save()
+	return nil
+}
+
+// 删除数据源
+func (service *DatasourceService) DeleteDatasource(code string) error {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	// 仍被监控引用时禁止删除
+	usages := service.GetUsages(code)
+	if len(usages) > 0 {
+		apps := make([]string, len(usages))
+		for i, watcher := range usages {
+			apps[i] = watcher.App
+		}
+		return fmt.Errorf("%w: %s", modules.ErrDatasourceInUse, strings.Join(apps, ","))
+	}
+	l := len(*service.Datasources)
+	i := 0
+	datasources := *service.Datasources
+	for _, datasource := range *service.Datasources {
+		if datasource.Code != code {
+			(*service.Datasources)[i] = datasource
+			i++
+		} else {
+			datasource.Close()
+		}
+	}
+	if l == i {
+		return modules.ErrDatasourceNotFound
+	} else {
+		(*service.Datasources) = datasources[:i]
+		service.Config.Save()
+		return nil
+	}
+}
+
+// 测试已保存的数据源连接
+func (service *DatasourceService) TestDatasource(code string, timeout time.Duration) (*modules.DatasourceTestResult, error) {
+	datasource, err := service.GetDatasource(code)
+	if err != nil {
+		return nil, err
+	}
+	return datasource.Test(timeout), nil
+}
+
+// 测试未保存的数据源连接
+func (service *DatasourceService) TestNewDatasource(new *modules.Datasource, timeout time.Duration) (*modules.DatasourceTestResult, error) {
+	err := new.Validate()
+	if err != nil && err != modules.ErrDatasourceNoCode {
+		return nil, err
+	}
+	return new.Test(timeout), nil
+}
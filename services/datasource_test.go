@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"server/modules"
+	"testing"
+)
+
+// 在临时目录中创建数据源服务，配置保存到临时目录
+func newTestDatasourceService(t *testing.T, datasources ...*modules.Datasource) *DatasourceService {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	watchers := []*modules.WatcherConfig{}
+	config := &modules.Config{Datasources: &datasources, Watchers: &watchers}
+	return NewDatasourceService(config, config.Datasources, config.Watchers)
+}
+
+func TestCreateDatasourceReservedCode(t *testing.T) {
+	service := newTestDatasourceService(t)
+	err := service.CreateDatasource(&modules.Datasource{Code: " test ", Type: modules.DatasourceTypeSQLite, DSN: "file::memory:"})
+	if !errors.Is(err, modules.ErrDatasourceReserved) {
+		t.Errorf("unexpected error %v", err)
+	}
+	err = service.CreateDatasource(&modules.Datasource{Code: "test-db", Type: modules.DatasourceTypeSQLite, DSN: "file::memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if codes := service.GetDatasources(); len(codes) != 1 || codes[0] != "test-db" {
+		t.Errorf("unexpected datasources %v", codes)
+	}
+}
+
+func TestUpdateDatasourceClear(t *testing.T) {
+	datasource := &modules.Datasource{Code: "WMS", Type: modules.DatasourceTypeMySQL, DSN: "root:secret@tcp(10.0.0.1:3306)/wms", Password: "secret", Token: "token"}
+	service := newTestDatasourceService(t, datasource)
+
+	// 未传入且未列入Clear时沿用原值
+	err := service.UpdateDatasource("WMS", &modules.Datasource{Type: modules.DatasourceTypeMySQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datasource.DSN != "root:secret@tcp(10.0.0.1:3306)/wms" || datasource.Password != "secret" || datasource.Token != "token" {
+		t.Fatalf("write-only fields are not kept %+v", datasource)
+	}
+
+	// 由连接串切换为分项配置
+	err = service.UpdateDatasource("WMS", &modules.Datasource{
+		Type:     modules.DatasourceTypeMySQL,
+		Server:   "10.0.0.2",
+		Database: "wms",
+		Username: "watcher",
+		Options:  map[string]string{"timeout": "5s"},
+		Clear:    []string{"DSN", "Token"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datasource.DSN != "" || datasource.Token != "" || datasource.Password != "secret" {
+		t.Fatalf("unexpected write-only fields %+v", datasource)
+	}
+	if dsn := datasource.GetDSN(); dsn != "watcher:secret@tcp(10.0.0.2:3306)/wms?loc=Local&parseTime=true&timeout=5s&charset=utf8mb4" {
+		t.Errorf("unexpected dsn %s", dsn)
+	}
+	if datasource.Clear != nil {
+		t.Errorf("clear is saved %v", datasource.Clear)
+	}
+
+	err = service.UpdateDatasource("WMS", &modules.Datasource{Type: modules.DatasourceTypeMySQL, Server: "10.0.0.2", Clear: []string{"Password"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if datasource.Password != "" {
+		t.Errorf("password is not cleared")
+	}
+
+	err = service.UpdateDatasource("WMS", &modules.Datasource{Type: modules.DatasourceTypeMySQL, Clear: []string{"Username"}})
+	if !errors.Is(err, modules.ErrDatasourceNotSupport) {
+		t.Errorf("unexpected error %v", err)
+	}
+}
@@ -11,3 +11,8 @@ func NewElasticService(elastic *modules.Elastic) *ElasticService {
 		Elastic: elastic,
 	}
 }
+
+// 获取批量写入统计
+func (service *ElasticService) GetStats() modules.ElasticStats {
+	return service.Elastic.GetStats()
+}
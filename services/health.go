@@ -0,0 +1,44 @@
+package services
+
+import "server/modules"
+
+var (
+	HealthStatusOK       = "ok"
+	HealthStatusDegraded = "degraded"
+)
+
+// 服务健康状态
+type Health struct {
+	Status    string                // 状态，依赖异常时为degraded
+	Scheduler int8                  // 调度器状态
+	Elastic   modules.ElasticHealth // Elasticsearch状态
+	History   bool                  // 运行历史是否可用
+}
+
+type HealthService struct {
+	Scheduler *modules.Scheduler
+	Elastic   *modules.Elastic
+	History   *modules.History
+}
+
+func NewHealthService(scheduler *modules.Scheduler, elastic *modules.Elastic, history *modules.History) *HealthService {
+	return &HealthService{
+		Scheduler: scheduler,
+		Elastic:   elastic,
+		History:   history,
+	}
+}
+
+// 获取健康状态，Elasticsearch未启用不视为异常
+func (service *HealthService) GetHealth() Health {
+	health := Health{
+		Status:    HealthStatusOK,
+		Scheduler: service.Scheduler.Status,
+		Elastic:   service.Elastic.GetHealth(),
+		History:   service.History.DB != nil,
+	}
+	if health.Elastic.State == modules.ElasticStateDown || health.Elastic.State == modules.ElasticStateConnecting || !health.History {
+		health.Status = HealthStatusDegraded
+	}
+	return health
+}
@@ -8,21 +8,28 @@ type SchedulerService struct {
 	Watchers    *[]*modules.WatcherConfig
 	Datasources *[]*modules.Datasource
 	Scheduler   *modules.Scheduler
-	Elastic     *modules.Elastic
+	Sinks       *modules.SinkManager
+	Alerts      *modules.AlertManager
+	Notifier    *modules.Notifier
+	History     *modules.History
 }
 
-func NewSchedulerService(watchers *[]*modules.WatcherConfig, datasources *[]*modules.Datasource, scheduler *modules.Scheduler, elastic *modules.Elastic) *SchedulerService {
+func NewSchedulerService(watchers *[]*modules.WatcherConfig, datasources *[]*modules.Datasource, scheduler *modules.Scheduler, sinks *modules.SinkManager, alerts *modules.AlertManager, notifier *modules.Notifier, history *modules.History) *SchedulerService {
 	return &SchedulerService{
 		Watchers:    watchers,
 		Datasources: datasources,
 		Scheduler:   scheduler,
-		Elastic:     elastic,
+		Sinks:       sinks,
+		Alerts:      alerts,
+		Notifier:    notifier,
+		History:     history,
 	}
 }
 
 // 开启调度
 func (service SchedulerService) Start() {
-	service.Scheduler.Start(service.Watchers, service.Datasources, service.Elastic)
+	service.Scheduler.Start(service.Watchers, service.Datasources, service.Sinks, service.Alerts, service.History)
+	service.Notifier.Start(service.Scheduler.Cron)
 }
 
 // 停止调度
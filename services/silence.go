@@ -0,0 +1,132 @@
+package services
+
+import (
+	"log"
+	"server/modules"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+type SilenceService struct {
+	Config   *modules.Config
+	Silences *[]*modules.Silence
+}
+
+func NewSilenceService(config *modules.Config, silences *[]*modules.Silence) *SilenceService {
+	return &SilenceService{
+		Config:   config,
+		Silences: silences,
+	}
+}
+
+// 获取静默列表，active为true时仅返回当前生效的静默
+func (service *SilenceService) GetSilences(active bool) []*modules.Silence {
+	silences := make([]*modules.Silence, 0, len(*service.Silences))
+	now := time.Now()
+	for _, silence := range *service.Silences {
+		if active && !silence.IsActive(now) {
+			continue
+		}
+		silences = append(silences, silence)
+	}
+	return silences
+}
+
+// 获取静默
+func (service *SilenceService) GetSilence(id string) (*modules.Silence, error) {
+	for _, silence := range *service.Silences {
+		if silence.ID == id {
+			return silence, nil
+		}
+	}
+	return nil, modules.ErrSilenceNotFound
+}
+
+// 创建静默
+func (service *SilenceService) CreateSilence(new *modules.Silence) error {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	err := new.Validate()
+	if err != nil {
+		return err
+	}
+	new.ID = modules.NewSilenceID()
+	new.CreatedAt = time.Now().Local()
+	// 复制后替换，通知发送时无需加锁读取
+	silences := append(append([]*modules.Silence{}, *service.Silences...), new)
+	(*service.Silences) = silences
+	service.Config.Save()
+	return nil
+}
+
+// 更新静默
+func (service *SilenceService) UpdateSilence(id string, new *modules.Silence) error {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	old, err := service.GetSilence(id)
+	if err != nil {
+		return err
+	}
+	err = new.Validate()
+	if err != nil {
+		return err
+	}
+	new.ID = id
+	new.CreatedAt = old.CreatedAt
+	silences := make([]*modules.Silence, len(*service.Silences))
+	for i, silence := range *service.Silences {
+		if silence.ID == id {
+			silence = new
+		}
+		silences[i] = silence
+	}
+	(*service.Silences) = silences
+	service.Config.Save()
+	return nil
+}
+
+// 删除静默
+func (service *SilenceService) DeleteSilence(id string) error {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	silences := make([]*modules.Silence, 0, len(*service.Silences))
+	for _, silence := range *service.Silences {
+		if silence.ID != id {
+			silences = append(silences, silence)
+		}
+	}
+	if len(silences) == len(*service.Silences) {
+		return modules.ErrSilenceNotFound
+	}
+	(*service.Silences) = silences
+	service.Config.Save()
+	return nil
+}
+
+// 清理已过期的静默
+func (service *SilenceService) PurgeSilences() {
+	service.Config.Mutex.Lock()
+	defer service.Config.Mutex.Unlock()
+	now := time.Now()
+	silences := make([]*modules.Silence, 0, len(*service.Silences))
+	for _, silence := range *service.Silences {
+		if !silence.IsExpired(now) {
+			silences = append(silences, silence)
+		}
+	}
+	if len(silences) == len(*service.Silences) {
+		return
+	}
+	log.Printf("Purge %d expired silences", len(*service.Silences)-len(silences))
+	(*service.Silences) = silences
+	service.Config.Save()
+}
+
+// 在调度器中添加过期静默清理任务
+func (service *SilenceService) Start(cron *cron.Cron) {
+	_, err := cron.AddFunc("@every 1m", service.PurgeSilences)
+	if err != nil {
+		log.Printf("Add silence purge failed: %v", err)
+	}
+}
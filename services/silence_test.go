@@ -0,0 +1,34 @@
+package services
+
+import (
+	"os"
+	"server/modules"
+	"testing"
+	"time"
+)
+
+func TestPurgeSilences(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	now := time.Now()
+	silences := []*modules.Silence{
+		{ID: "expired", App: "order", StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)},
+		{ID: "active", App: "order", StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)},
+		{ID: "window", App: "order", From: "02:00", To: "04:00"},
+	}
+	config := &modules.Config{Silences: &silences}
+	service := NewSilenceService(config, config.Silences)
+	service.PurgeSilences()
+	if len(*service.Silences) != 2 || (*service.Silences)[0].ID != "active" || (*service.Silences)[1].ID != "window" {
+		t.Errorf("unexpected silences %v", *service.Silences)
+	}
+}
@@ -3,8 +3,11 @@ package services
 import (
 	"errors"
 	"fmt"
+	"log"
 	"server/modules"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/robfig/cron/v3"
 )
@@ -17,17 +20,23 @@ type WatcherService struct {
 	DatasourceService *DatasourceService
 	Datasources       *[]*modules.Datasource
 	Scheduler         *modules.Scheduler
-	Elastic           *modules.Elastic
+	Sinks             *modules.SinkManager
+	Alerts            *modules.AlertManager
+	Notifier          *modules.Notifier
+	History           *modules.History
 }
 
-func NewWatcherService(config *modules.Config, watchers *[]*modules.WatcherConfig, datasourceService *DatasourceService, datasources *[]*modules.Datasource, scheduler *modules.Scheduler, elastic *modules.Elastic) *WatcherService {
+func NewWatcherService(config *modules.Config, watchers *[]*modules.WatcherConfig, datasourceService *DatasourceService, datasources *[]*modules.Datasource, scheduler *modules.Scheduler, sinks *modules.SinkManager, alerts *modules.AlertManager, notifier *modules.Notifier, history *modules.History) *WatcherService {
 	return &WatcherService{
 		Config:            config,
 		Watchers:          watchers,
 		DatasourceService: datasourceService,
 		Datasources:       datasources,
 		Scheduler:         scheduler,
-		Elastic:           elastic,
+		Sinks:             sinks,
+		Alerts:            alerts,
+		Notifier:          notifier,
+		History:           history,
 	}
 }
 
@@ -46,6 +55,24 @@ func (service *WatcherService) GetWatcher(app string) (*modules.WatcherConfig, e
 	return nil, ErrWatcherNotFound
 }
 
+// 按数据源类型校验响应映射
+func (service *WatcherService) validateMapping(watcher *modules.WatcherConfig) error {
+	if watcher.Mapping == nil {
+		return nil
+	}
+	for _, code := range watcher.Sources {
+		datasource, err := service.DatasourceService.GetDatasource(code)
+		if err != nil {
+			return err
+		}
+		err = watcher.Mapping.Validate(datasource.Type)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // 创建监控
 func (service *WatcherService) CreateWatcher(new *modules.WatcherConfig) error {
 	service.Config.Mutex.Lock()
@@ -60,6 +87,42 @@ func (service *WatcherService) CreateWatcher(new *modules.WatcherConfig) error {
 	if old != nil {
 		return errors.New("app is duplicated")
 	}
+	err = service.DatasourceService.CheckDatasources(new.Sources)
+	if err != nil {
+		return err
+	}
+	err = service.validateMapping(new)
+	if err != nil {
+		return err
+	}
+	err = new.ValidateRequest()
+	if err != nil {
+		return err
+	}
+	err = modules.ValidatePatterns(new.Patterns)
+	if err != nil {
+		return err
+	}
+	err = modules.ValidateBuckets(new.Buckets)
+	if err != nil {
+		return err
+	}
+	err = modules.ValidateAlertRules(new.Alerts)
+	if err != nil {
+		return err
+	}
+	err = service.Notifier.CheckChannels(new.Channels)
+	if err != nil {
+		return err
+	}
+	err = service.Sinks.CheckSinks(new.Sinks)
+	if err != nil {
+		return err
+	}
+	err = service.Sinks.CheckTopic(new)
+	if err != nil {
+		return err
+	}
 	watchers := append(*service.Watchers, new)
 	(*service.Watchers) = watchers
 	service.Config.Save()
@@ -74,25 +137,54 @@ func (service *WatcherService) UpdateWatcher(app string, new *modules.WatcherCon
 	if err != nil {
 		return err
 	}
+	err = service.DatasourceService.CheckDatasources(new.Sources)
+	if err != nil {
+		return err
+	}
+	err = service.validateMapping(new)
+	if err != nil {
+		return err
+	}
+	err = new.ValidateRequest()
+	if err != nil {
+		return err
+	}
+	err = modules.ValidatePatterns(new.Patterns)
+	if err != nil {
+		return err
+	}
+	err = modules.ValidateBuckets(new.Buckets)
+	if err != nil {
+		return err
+	}
+	err = modules.ValidateAlertRules(new.Alerts)
+	if err != nil {
+		return err
+	}
+	err = service.Notifier.CheckChannels(new.Channels)
+	if err != nil {
+		return err
+	}
+	err = service.Sinks.CheckSinks(new.Sinks)
+	if err != nil {
+		return err
+	}
+	err = service.Sinks.CheckTopic(new)
+	if err != nil {
+		return err
+	}
 	for i, watcher := range *service.Watchers {
 		if watcher.App == app {
-			switch {
-			case !new.Enabled:
-				watcher.Disable(service.Scheduler.Cron)
-			case watcher.Cron != new.Cron:
-				watcher.Stop(service.Scheduler.Cron)
-			// case watcher.DataConfig.Type != new.DataConfig.Type:
-			// 	watcher.Stop(service.Scheduler.Cron)
-			// case watcher.DataConfig.DSN != new.DataConfig.DSN:
-			// 	watcher.Stop(service.Scheduler.Cron)
-			case watcher.GetExpired != new.GetExpired:
-				watcher.Stop(service.Scheduler.Cron)
+			// 调度任务绑定原配置，任何修改均重新创建
+			watcher.Stop(service.Scheduler.Cron)
+			if !slices.Equal(watcher.Alerts, new.Alerts) {
+				// 规则变化后重新评估
+				service.Alerts.Remove(app)
 			}
 			new.App = app
-			new.EntryID = watcher.EntryID
 			(*service.Watchers)[i] = new
 			if new.Enabled {
-				new.Start(service.Scheduler.Cron, service.Datasources, service.Elastic)
+				new.Start(service.Scheduler.Cron, service.Datasources, service.Sinks, service.Alerts, service.History)
 			}
 			service.Config.Save()
 		}
@@ -113,6 +205,8 @@ func (service *WatcherService) DeleteWatcher(app string) error {
 			i++
 		} else {
 			watcher.Disable(service.Scheduler.Cron)
+			service.Alerts.Remove(app)
+			modules.RemoveWatcherMetrics(app)
 		}
 	}
 	if l == i {
@@ -159,7 +253,7 @@ func (service *WatcherService) StartWatcher(app string) (cron.EntryID, error) {
 	if err != nil {
 		return 0, err
 	}
-	return watcher.Start(service.Scheduler.Cron, service.Datasources, service.Elastic)
+	return watcher.Start(service.Scheduler.Cron, service.Datasources, service.Sinks, service.Alerts, service.History)
 }
 
 // 停止监控
@@ -172,7 +266,7 @@ func (service *WatcherService) StopWatcher(app string) error {
 	return nil
 }
 
-// 监控数据预览
+// 监控数据预览，记录为preview运行
 func (service *WatcherService) DataPreviewWatcher(app string, datasourceCode string) (*[]modules.ExpiredData, error) {
 	watcher, err := service.GetWatcher(app)
 	if err != nil {
@@ -182,7 +276,34 @@ func (service *WatcherService) DataPreviewWatcher(app string, datasourceCode str
 	if err != nil {
 		return nil, err
 	}
-	return watcher.GenerateGetExpiredDataFunc(datasource, service.Elastic)()
+	run := modules.NewWatcherRun(app, modules.RunTriggerPreview)
+	start := time.Now()
+	datas, err := watcher.GenerateGetExpiredDataFunc(datasource, service.Sinks)()
+	run.AddSource(datasourceCode, start, datas, err)
+	run.Finish()
+	saveErr := service.History.Save(run)
+	if saveErr != nil {
+		log.Printf("Save run of %s failed: %v", app, saveErr)
+	}
+	return datas, err
+}
+
+// 立即运行监控，返回运行记录
+func (service *WatcherService) RunWatcher(app string) (*modules.WatcherRun, error) {
+	watcher, err := service.GetWatcher(app)
+	if err != nil {
+		return nil, err
+	}
+	return watcher.GetExpiredDataFunc(service.Datasources, service.Sinks, service.Alerts, service.History)(modules.RunTriggerManual), nil
+}
+
+// 分页获取监控运行记录
+func (service *WatcherService) GetRuns(app string, page int, size int) (*modules.PagedList[modules.WatcherRun], error) {
+	_, err := service.GetWatcher(app)
+	if err != nil {
+		return nil, err
+	}
+	return service.History.GetRuns(app, page, size)
 }
 
 // 获取监控状态
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"server/modules"
+	"testing"
+	"time"
+)
+
+// 在临时目录中创建监控服务，配置保存到临时目录
+func newTestWatcherService(t *testing.T, watcher *modules.WatcherConfig) (*WatcherService, *modules.MemorySink) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.Chdir(wd)
+	})
+	data := filepath.Join(dir, "data")
+	err = os.Mkdir(data, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 3个滞留2天的文件
+	for _, name := range []string{"a.csv", "b.csv", "c.csv"} {
+		path := filepath.Join(data, name)
+		err = os.WriteFile(path, []byte("data"), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-48 * time.Hour)
+		err = os.Chtimes(path, mtime, mtime)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	datasources := []*modules.Datasource{{Code: "FS", Type: modules.DatasourceTypeFilesystem, Path: data}}
+	watchers := []*modules.WatcherConfig{watcher}
+	config := &modules.Config{
+		Datasources: &datasources,
+		Watchers:    &watchers,
+	}
+	scheduler := &modules.Scheduler{}
+	scheduler.Init()
+	memory := modules.NewMemorySink(0)
+	sinks := modules.NewSinkManager(nil, nil)
+	sinks.Add("memory", memory)
+	alerts := modules.NewAlertManager()
+	datasourceService := NewDatasourceService(config, config.Datasources, config.Watchers)
+	service := NewWatcherService(config, config.Watchers, datasourceService, config.Datasources, scheduler, sinks, alerts, &modules.Notifier{}, nil)
+	_, err = service.StartWatcher(watcher.App)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return service, memory
+}
+
+// 执行调度器中的监控任务
+func runScheduled(t *testing.T, service *WatcherService, app string) {
+	t.Helper()
+	watcher, err := service.GetWatcher(app)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := service.Scheduler.Cron.Entry(watcher.EntryID)
+	if entry.Job == nil {
+		t.Fatalf("watcher %s is not scheduled", app)
+	}
+	entry.Job.Run()
+}
+
+func TestUpdateWatcherRestartsSchedule(t *testing.T) {
+	watcher := &modules.WatcherConfig{
+		App:     "fs",
+		Sources: []string{"FS"},
+		Sinks:   []string{"memory"},
+		Cron:    "0 0 *",
+		Enabled: true,
+		Alerts:  []modules.AlertRule{{Name: "backlog", Expr: "Expire1Day > 5", Severity: modules.AlertSeverityWarning}},
+	}
+	service, memory := newTestWatcherService(t, watcher)
+	runScheduled(t, service, "fs")
+	if alerts := service.Alerts.GetAlerts(false); len(alerts) != 0 {
+		t.Fatalf("unexpected alerts %v", alerts)
+	}
+
+	// 仅修改告警规则及分段，Cron不变
+	updated := &modules.WatcherConfig{
+		Sources: watcher.Sources,
+		Sinks:   watcher.Sinks,
+		Cron:    watcher.Cron,
+		Enabled: true,
+		Alerts:  []modules.AlertRule{{Name: "backlog", Expr: "Stale > 2", Severity: modules.AlertSeverityWarning}},
+		Buckets: []modules.Bucket{{Name: "Stale", Threshold: "1d"}},
+	}
+	err := service.UpdateWatcher("fs", updated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, _ := service.GetWatcher("fs")
+	if current != updated || current.EntryID == 0 || watcher.EntryID != 0 {
+		t.Fatalf("watcher is not rescheduled, entry %d, old entry %d", current.EntryID, watcher.EntryID)
+	}
+	runScheduled(t, service, "fs")
+	alerts := service.Alerts.GetAlerts(false)
+	if len(alerts) != 1 || alerts[0].State != modules.AlertStateFiring || alerts[0].Expr != "Stale > 2" {
+		t.Errorf("updated alert rule is not used, alerts %v", alerts)
+	}
+	datas := memory.GetDatas()
+	if last := datas[len(datas)-1]; last.Buckets["Stale"] != 3 {
+		t.Errorf("updated buckets are not used, buckets %v", last.Buckets)
+	}
+	if len(current.Latest) != 1 || len(watcher.Latest) != 1 {
+		t.Errorf("unexpected latest results %d %d", len(current.Latest), len(watcher.Latest))
+	}
+}
+
+func TestWatcherKafkaTopic(t *testing.T) {
+	watcher := &modules.WatcherConfig{App: "fs", Sources: []string{"FS"}, Sinks: []string{"memory"}, Cron: "0 0 *", Enabled: true}
+	service, _ := newTestWatcherService(t, watcher)
+	kafka, err := modules.NewKafkaSink(&modules.SinkConfig{Name: "kafka", Type: modules.SinkTypeKafka, Brokers: []string{"127.0.0.1:9092"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Sinks.Add("kafka", kafka)
+
+	// 未选择Kafka输出时不校验
+	err = service.CreateWatcher(&modules.WatcherConfig{App: "mqtt", Sources: []string{"FS"}, Sinks: []string{"memory"}, Topic: "plant/{App}"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = service.CreateWatcher(&modules.WatcherConfig{App: "kafka", Sources: []string{"FS"}, Sinks: []string{"memory", "kafka"}, Topic: "plant/{App}"})
+	if !errors.Is(err, modules.ErrKafkaTopicInvalid) {
+		t.Errorf("expected invalid topic, got %v", err)
+	}
+	err = service.UpdateWatcher("fs", &modules.WatcherConfig{Sources: []string{"FS"}, Sinks: []string{"kafka"}, Topic: "plant #1"})
+	if !errors.Is(err, modules.ErrKafkaTopicInvalid) {
+		t.Errorf("expected invalid topic, got %v", err)
+	}
+	err = service.UpdateWatcher("fs", &modules.WatcherConfig{Sources: []string{"FS"}, Sinks: []string{"kafka"}, Topic: "plant.{System}.{App}"})
+	if err != nil {
+		t.Error(err)
+	}
+}